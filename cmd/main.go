@@ -1,44 +1,105 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"stocks-info-channel/config"
 	"stocks-info-channel/helper"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/market"
+	"stocks-info-channel/metrics"
 	"stocks-info-channel/routes"
+	"stocks-info-channel/services"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
-func init() {
-	err := godotenv.Load()
+func connectTODB(ctx context.Context, cfg *config.Config) *sql.DB {
+	db, err := sql.Open("postgres", cfg.DBURL)
 	if err != nil {
-		fmt.Println("Error loading .env file:", err)
+		slog.Error("failed to open database", "error", err)
+		os.Exit(1)
 	}
+
+	// Check connection
+	err = db.PingContext(ctx)
+	if err != nil {
+		slog.Error("failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("connected to PostgreSQL successfully")
+	return db
 }
 
-func connectTODB() *sql.DB {
-	connStr := os.Getenv(helper.EnvironmentConstant().DB_URL)
-	db, err := sql.Open("postgres", connStr)
+func main() {
+	cfg, err := config.Load()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Check connection
-	err = db.Ping()
+	logger, err := logging.New(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println("Connected to PostgreSQL successfully!")
-	return db
-}
+	slog.SetDefault(logger)
+	logger.Debug("loaded configuration", "config", cfg.String())
 
-func main() {
-	db := connectTODB()
-	router := gin.Default()
+	if cfg.TemplateDir != "" {
+		if err := helper.LoadTemplates(cfg.TemplateDir); err != nil {
+			log.Fatalf("loading message templates: %v", err)
+		}
+		logger.Info("loaded message template overrides", "dir", cfg.TemplateDir)
+	}
+	if cfg.MarketCalendarFile != "" {
+		cal, err := market.LoadCalendar(cfg.MarketCalendarFile)
+		if err != nil {
+			log.Fatalf("loading market calendar: %v", err)
+		}
+		logger.Info("loaded market calendar", "file", cfg.MarketCalendarFile, "version", cal.Version)
+	}
+
+	// ctx is cancelled on SIGINT/SIGTERM, which starts the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	gin.SetMode(cfg.GinMode)
+	db := connectTODB(ctx, cfg)
+	defer db.Close()
+
+	// Background workers run until shutdown and are waited for before exiting
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	startWorker := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workerCtx)
+		}()
+	}
+
+	// Shared across requests so each provider's circuit breaker sees every call
+	quotes := services.NewQuoteChain(cfg)
+	limiter := services.NewUserLimiter(cfg)
+
+	startWorker(func(ctx context.Context) { services.RunQuoteCacheJanitor(ctx, time.Minute) })
+	startWorker(func(ctx context.Context) { limiter.RunJanitor(ctx, time.Minute, time.Hour) })
+	startWorker(func(ctx context.Context) {
+		services.RunBroadcastScheduler(ctx, db, cfg, cfg.BroadcastPollInterval)
+	})
+
+	router := gin.New()
+	router.Use(gin.Recovery(), logging.Middleware(logger), metrics.Middleware(), routes.RequestTimeout(cfg.RequestTimeout))
 	// Health check endpoint for Render
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -46,12 +107,35 @@ func main() {
 			"message": "Service is running",
 		})
 	})
-	router.POST("whatsapp", routes.WhatsAppIncomingHandler(db))
-	router.GET("alert", routes.StockAlertHandler(db))
+	router.POST("whatsapp", routes.TwilioSignature(cfg), routes.WhatsAppIncomingHandler(db, cfg, quotes, limiter))
+	router.GET("alert", routes.StockAlertHandler(db, cfg))
+	router.GET("metrics", metrics.Handler())
+	router.GET(services.TaxReportPath+":user/:fy", routes.TaxReportHandler(db, cfg))
+	routes.RegisterAdminRoutes(router, db, cfg, quotes)
+
+	server := &http.Server{
+		Addr:    ":" + strconv.Itoa(cfg.Port),
+		Handler: router,
+	}
 
-	port := os.Getenv(helper.EnvironmentConstant().PORT)
-	if port == "" {
-		port = helper.AppConstant().DefaultPort
+	go func() {
+		logger.Info("server listening", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("server failed", "error", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Info("shutting down, draining in-flight requests", "timeout", cfg.ShutdownTimeout.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("graceful shutdown failed", "error", err)
 	}
-	router.Run(":" + port)
+
+	stopWorkers()
+	workers.Wait()
+	logger.Info("shutdown complete")
 }
@@ -0,0 +1,353 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"stocks-info-channel/helper"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the service needs. Values are resolved in order:
+// `default` tag, optional YAML file, then environment (including .env).
+// Fields tagged `required` must end up non-empty and `secret` fields are
+// redacted when the config is printed.
+type Config struct {
+	DBURL   string `env:"DB_URL" yaml:"db_url" required:"true" secret:"true"`
+	GinMode string `env:"GIN_MODE" yaml:"gin_mode" default:"debug"`
+	Port    int    `env:"PORT" yaml:"port" default:"8080"`
+
+	// RequestTimeout bounds each webhook; Twilio itself gives up after 15s
+	RequestTimeout  time.Duration `env:"REQUEST_TIMEOUT" yaml:"request_timeout" default:"14s"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" default:"20s"`
+
+	// LogShowPII unmasks phone numbers and message bodies, honoured only at debug level
+	LogLevel   string `env:"LOG_LEVEL" yaml:"log_level" default:"info"`
+	LogShowPII bool   `env:"LOG_SHOW_PII" yaml:"log_show_pii" default:"false"`
+
+	// TemplateDir holds *.tmpl files that override the built-in message copy
+	TemplateDir string `env:"TEMPLATE_DIR" yaml:"template_dir"`
+
+	// MarketCalendarFile replaces the built-in NSE holiday and session calendar
+	MarketCalendarFile string `env:"MARKET_CALENDAR_FILE" yaml:"market_calendar_file"`
+
+	TwilioAccountSID string `env:"TWILIO_ACCOUNT_SID" yaml:"twilio_account_sid" required:"true"`
+	TwilioAuthToken  string `env:"TWILIO_AUTH_TOKEN" yaml:"twilio_auth_token" required:"true" secret:"true"`
+	PhoneNumber      string `env:"PHONE_NUMBER" yaml:"phone_number" required:"true"`
+	// TwilioVerifySignature checks X-Twilio-Signature on webhooks; turn it off
+	// only to post test messages by hand
+	TwilioVerifySignature bool `env:"TWILIO_VERIFY_SIGNATURE" yaml:"twilio_verify_signature" default:"true"`
+
+	// Content API templates keyed by option count, e.g. "2=HX...,3=HX..."
+	TwilioQuickReplySIDs map[int]string `env:"TWILIO_QUICK_REPLY_SIDS" yaml:"twilio_quick_reply_sids"`
+	TwilioListPickerSIDs map[int]string `env:"TWILIO_LIST_PICKER_SIDS" yaml:"twilio_list_picker_sids"`
+
+	// QuoteProviders is an ordered failover chain of "name=url" entries; quotes
+	// are fetched from url + symbol. STOCK_PRICE_URL alone acts as a single provider.
+	QuoteProviders []string `env:"QUOTE_PROVIDERS" yaml:"quote_providers"`
+	StockPriceURL  string   `env:"STOCK_PRICE_URL" yaml:"stock_price_url"`
+	// QuoteCacheTTL reuses a fetched quote for this long; zero, the default, always fetches
+	QuoteCacheTTL time.Duration `env:"QUOTE_CACHE_TTL" yaml:"quote_cache_ttl"`
+	// PerformanceHorizons are shown in stock replies unless the user asks for others
+	PerformanceHorizons []string `env:"PERFORMANCE_HORIZONS" yaml:"performance_horizons" default:"1M,1Y,5Y"`
+	// ExchangeSuffixes turns a listing into a provider ticker, e.g. RELIANCE on
+	// BSE -> RELIANCE.BO. Keys are "EXCHANGE" for every provider or
+	// "provider:EXCHANGE" for one provider only.
+	ExchangeSuffixes map[string]string `env:"EXCHANGE_SUFFIXES" yaml:"exchange_suffixes" default:"NSE=.NS,BSE=.BO"`
+
+	// Inbound commands per user tier and upstream quote calls overall, as "count/duration"
+	UserRateLimits map[string]string `env:"USER_RATE_LIMITS" yaml:"user_rate_limits" default:"free=5/1m,premium=30/1m"`
+	QuoteRateLimit string            `env:"QUOTE_RATE_LIMIT" yaml:"quote_rate_limit" default:"10/1s"`
+
+	// Quote provider HTTP behaviour: timeout per attempt, retries on 5xx/429 and circuit breaker
+	UpstreamTimeout         time.Duration `env:"UPSTREAM_TIMEOUT" yaml:"upstream_timeout" default:"4s"`
+	UpstreamMaxRetries      int           `env:"UPSTREAM_MAX_RETRIES" yaml:"upstream_max_retries" default:"2"`
+	UpstreamRetryBaseDelay  time.Duration `env:"UPSTREAM_RETRY_BASE_DELAY" yaml:"upstream_retry_base_delay" default:"200ms"`
+	BreakerFailureThreshold int           `env:"BREAKER_FAILURE_THRESHOLD" yaml:"breaker_failure_threshold" default:"5"`
+	BreakerCooldown         time.Duration `env:"BREAKER_COOLDOWN" yaml:"breaker_cooldown" default:"30s"`
+
+	// PublicBaseURL is where users and Twilio reach this service, e.g.
+	// https://stocks.example.com. Webhook signatures are checked against it and
+	// report downloads are linked under it, signed with ReportSigningKey;
+	// without both, reports are sent without a download link.
+	PublicBaseURL    string        `env:"PUBLIC_BASE_URL" yaml:"public_base_url"`
+	ReportSigningKey string        `env:"REPORT_SIGNING_KEY" yaml:"report_signing_key" secret:"true"`
+	ReportLinkTTL    time.Duration `env:"REPORT_LINK_TTL" yaml:"report_link_ttl" default:"24h"`
+
+	// AdminAPIToken guards /admin as a bearer token; the admin API is off when empty
+	AdminAPIToken         string        `env:"ADMIN_API_TOKEN" yaml:"admin_api_token" secret:"true"`
+	BroadcastPollInterval time.Duration `env:"BROADCAST_POLL_INTERVAL" yaml:"broadcast_poll_interval" default:"30s"`
+	// BroadcastRatePerMinute is the send rate for broadcasts that don't set their own
+	BroadcastRatePerMinute int `env:"BROADCAST_RATE_PER_MINUTE" yaml:"broadcast_rate_per_minute" default:"60"`
+}
+
+// ValidationError lists every problem found while loading the config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load reads .env (if present), the YAML file named by CONFIG_FILE (or
+// config.yaml when it exists) and the environment, then validates the result
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("loading .env file: %w", err)
+	}
+
+	cfg := &Config{}
+	var problems []string
+
+	forEachField(cfg, func(field reflect.StructField, value reflect.Value) {
+		if def, ok := field.Tag.Lookup("default"); ok {
+			if err := setFromString(value, def); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: bad default %q: %v", field.Name, def, err))
+			}
+		}
+	})
+
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		path = "config.yaml"
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+		}
+	} else if explicit || !errors.Is(err, os.ErrNotExist) {
+		problems = append(problems, fmt.Sprintf("reading config file: %v", err))
+	}
+
+	forEachField(cfg, func(field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("env")
+		raw, ok := os.LookupEnv(name)
+		if name == "" || !ok {
+			return
+		}
+		if err := setFromString(value, raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	})
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// validate checks required fields and value ranges
+func (c *Config) validate() []string {
+	var problems []string
+
+	forEachField(c, func(field reflect.StructField, value reflect.Value) {
+		if field.Tag.Get("required") == "true" && value.IsZero() {
+			problems = append(problems, fmt.Sprintf("%s is required but not set", field.Tag.Get("env")))
+		}
+	})
+
+	if c.Port <= 0 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT must be between 1 and 65535, got %d", c.Port))
+	}
+	if len(c.QuoteProviders) == 0 && c.StockPriceURL == "" {
+		problems = append(problems, "one of QUOTE_PROVIDERS or STOCK_PRICE_URL is required but neither is set")
+	}
+	for _, entry := range c.QuoteProviders {
+		if _, _, ok := strings.Cut(entry, "="); !ok {
+			problems = append(problems, fmt.Sprintf("QUOTE_PROVIDERS entry %q must look like name=url", entry))
+		}
+	}
+	for _, p := range c.Providers() {
+		if u, err := url.Parse(p.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("quote provider %s has an invalid URL: %q", p.Name, p.URL))
+		}
+	}
+
+	for _, horizon := range c.PerformanceHorizons {
+		if !slices.Contains(helper.AppConstant().Horizons, strings.ToUpper(horizon)) {
+			problems = append(problems, fmt.Sprintf("PERFORMANCE_HORIZONS has unknown horizon %q (known: %s)",
+				horizon, strings.Join(helper.AppConstant().Horizons, ", ")))
+		}
+	}
+
+	problems = append(problems, c.validateRateLimits()...)
+	if c.UpstreamTimeout <= 0 {
+		problems = append(problems, "UPSTREAM_TIMEOUT must be positive")
+	}
+	if c.UpstreamMaxRetries < 0 {
+		problems = append(problems, "UPSTREAM_MAX_RETRIES must not be negative")
+	}
+	if c.BreakerFailureThreshold < 1 {
+		problems = append(problems, "BREAKER_FAILURE_THRESHOLD must be at least 1")
+	}
+	if c.BroadcastPollInterval <= 0 {
+		problems = append(problems, "BROADCAST_POLL_INTERVAL must be positive")
+	}
+	if c.PublicBaseURL != "" {
+		if u, err := url.Parse(c.PublicBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("PUBLIC_BASE_URL is not a valid URL: %q", c.PublicBaseURL))
+		}
+	}
+	if c.ReportLinkTTL <= 0 {
+		problems = append(problems, "REPORT_LINK_TTL must be positive")
+	}
+	if c.BroadcastRatePerMinute < 1 {
+		problems = append(problems, "BROADCAST_RATE_PER_MINUTE must be at least 1")
+	}
+
+	return problems
+}
+
+// Provider is one entry of the quote provider chain
+type Provider struct {
+	Name     string
+	URL      string
+	Suffixes map[string]string // ticker suffix by exchange
+}
+
+// Providers returns the quote provider chain in order
+func (c *Config) Providers() []Provider {
+	if len(c.QuoteProviders) == 0 {
+		if c.StockPriceURL == "" {
+			return nil
+		}
+		return []Provider{{Name: "default", URL: c.StockPriceURL, Suffixes: c.suffixesFor("default")}}
+	}
+
+	var providers []Provider
+	for _, entry := range c.QuoteProviders {
+		if name, u, ok := strings.Cut(entry, "="); ok {
+			name = strings.TrimSpace(name)
+			providers = append(providers, Provider{Name: name, URL: strings.TrimSpace(u), Suffixes: c.suffixesFor(name)})
+		}
+	}
+	return providers
+}
+
+// suffixesFor merges the shared exchange suffixes with the provider's own overrides
+func (c *Config) suffixesFor(provider string) map[string]string {
+	suffixes := make(map[string]string)
+	for key, suffix := range c.ExchangeSuffixes {
+		if !strings.Contains(key, ":") {
+			suffixes[strings.ToUpper(key)] = suffix
+		}
+	}
+	for key, suffix := range c.ExchangeSuffixes {
+		if name, exchange, ok := strings.Cut(key, ":"); ok && name == provider {
+			suffixes[strings.ToUpper(exchange)] = suffix
+		}
+	}
+	return suffixes
+}
+
+// String prints every setting with secrets redacted
+func (c Config) String() string {
+	var sb strings.Builder
+	forEachField(&c, func(field reflect.StructField, value reflect.Value) {
+		shown := fmt.Sprint(value.Interface())
+		if field.Tag.Get("secret") == "true" {
+			shown = "(unset)"
+			if !value.IsZero() {
+				shown = "********"
+			}
+		}
+		sb.WriteString(fmt.Sprintf("%s=%s\n", field.Tag.Get("env"), shown))
+	})
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func forEachField(cfg *Config, fn func(reflect.StructField, reflect.Value)) {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		fn(t.Field(i), v.Field(i))
+	}
+}
+
+// setFromString parses raw into value according to its type. Slices are comma
+// separated and maps are comma separated key=value pairs.
+func setFromString(value reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", raw)
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if value.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return fmt.Errorf("expected a duration like 5s or 1m, got %q", raw)
+			}
+			value.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", raw)
+		}
+		value.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", raw)
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		items := splitList(raw)
+		slice := reflect.MakeSlice(value.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFromString(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+	case reflect.Map:
+		m := reflect.MakeMap(value.Type())
+		for _, item := range splitList(raw) {
+			k, v, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", item)
+			}
+			key := reflect.New(value.Type().Key()).Elem()
+			if err := setFromString(key, k); err != nil {
+				return err
+			}
+			val := reflect.New(value.Type().Elem()).Elem()
+			if err := setFromString(val, v); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, val)
+		}
+		value.Set(m)
+	default:
+		return fmt.Errorf("unsupported config type %s", value.Type())
+	}
+	return nil
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
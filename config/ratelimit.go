@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTier is used for users whose tier has no limit configured
+const DefaultTier = "free"
+
+// RateLimit allows Burst events per Per window, e.g. "5/1m"
+type RateLimit struct {
+	Burst int
+	Per   time.Duration
+}
+
+// ParseRateLimit reads a limit written as "<count>/<duration>", e.g. "5/1m"
+func ParseRateLimit(value string) (RateLimit, error) {
+	count, per, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("expected count/duration like 5/1m, got %q", value)
+	}
+	burst, err := strconv.Atoi(count)
+	if err != nil || burst < 1 {
+		return RateLimit{}, fmt.Errorf("count must be a positive integer, got %q", count)
+	}
+	window, err := time.ParseDuration(per)
+	if err != nil || window <= 0 {
+		return RateLimit{}, fmt.Errorf("duration must be positive like 1m, got %q", per)
+	}
+	return RateLimit{Burst: burst, Per: window}, nil
+}
+
+// UserRateLimit returns the inbound command limit for tier, falling back to DefaultTier
+func (c *Config) UserRateLimit(tier string) RateLimit {
+	value, ok := c.UserRateLimits[tier]
+	if !ok {
+		value = c.UserRateLimits[DefaultTier]
+	}
+	limit, _ := ParseRateLimit(value) // validated at load
+	return limit
+}
+
+// QuoteLimit returns the global limit on upstream quote calls
+func (c *Config) QuoteLimit() RateLimit {
+	limit, _ := ParseRateLimit(c.QuoteRateLimit) // validated at load
+	return limit
+}
+
+func (c *Config) validateRateLimits() []string {
+	var problems []string
+	if _, ok := c.UserRateLimits[DefaultTier]; !ok {
+		problems = append(problems, fmt.Sprintf("USER_RATE_LIMITS must configure the %q tier", DefaultTier))
+	}
+	for tier, value := range c.UserRateLimits {
+		if _, err := ParseRateLimit(value); err != nil {
+			problems = append(problems, fmt.Sprintf("USER_RATE_LIMITS tier %s: %v", tier, err))
+		}
+	}
+	if _, err := ParseRateLimit(c.QuoteRateLimit); err != nil {
+		problems = append(problems, fmt.Sprintf("QUOTE_RATE_LIMIT: %v", err))
+	}
+	return problems
+}
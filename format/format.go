@@ -0,0 +1,167 @@
+package format
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	lakh        = 1e5
+	crore       = 1e7
+	lakhCrore   = 1e12
+	rupeeSymbol = "₹"
+)
+
+// Number groups v Indian style with decimals digits after the point, e.g.
+// Number(125000.5, 2) is "1,25,000.50"
+func Number(v float64, decimals int) string {
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	whole, fraction, _ := strings.Cut(s, ".")
+
+	var sb strings.Builder
+	if isNegative(v, decimals) {
+		sb.WriteByte('-')
+	}
+	sb.WriteString(group(whole))
+	if fraction != "" {
+		sb.WriteByte('.')
+		sb.WriteString(fraction)
+	}
+	return sb.String()
+}
+
+// Rupee is an amount in rupees with paise, e.g. "₹1,25,000.50" or "-₹50.00"
+func Rupee(v float64) string {
+	return withSign(v, 2, "", rupeeSymbol+Number(math.Abs(v), 2))
+}
+
+// SignedRupee is a change in rupees, always signed unless it is zero: "+₹12.50"
+func SignedRupee(v float64) string {
+	return withSign(v, 2, "+", rupeeSymbol+Number(math.Abs(v), 2))
+}
+
+// Points is an index level, e.g. "24,812.35"
+func Points(v float64) string {
+	return Number(v, 2)
+}
+
+// SignedPoints is a change in index points: "+112.40"
+func SignedPoints(v float64) string {
+	return withSign(v, 2, "+", Number(math.Abs(v), 2))
+}
+
+// Quantity is a number of shares: whole numbers without decimals, fractional
+// ones with up to four, e.g. "1,200" or "0.5"
+func Quantity(v float64) string {
+	s := Number(v, 4)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// FinancialYear names the Indian financial year starting in April of start,
+// e.g. "FY2025-26"
+func FinancialYear(start int) string {
+	return "FY" + strconv.Itoa(start) + "-" + fmt.Sprintf("%02d", (start+1)%100)
+}
+
+// Percent is a percentage with two decimals: "12.34%"
+func Percent(v float64) string {
+	return Number(v, 2) + "%"
+}
+
+// SignedPercent is a percentage change, always signed unless it is zero: "+1.20%"
+func SignedPercent(v float64) string {
+	return withSign(v, 2, "+", Number(math.Abs(v), 2)+"%")
+}
+
+// Compact shortens large counts to lakhs and crores, e.g. "1.2 Cr" or "2.3 L Cr".
+// Values under a lakh are grouped in full.
+func Compact(v float64) string {
+	abs := math.Abs(v)
+	if math.Round(abs) < lakh {
+		return Number(v, 0)
+	}
+
+	units := []struct {
+		size float64
+		name string
+	}{{lakh, "L"}, {crore, "Cr"}, {lakhCrore, "L Cr"}}
+	i := 0
+	for i+1 < len(units) && abs >= units[i+1].size {
+		i++
+	}
+	// The unit is settled after rounding, so 99,99,999 is "1 Cr" and not "100 L"
+	scaled, decimals := compactScale(abs, units[i].size)
+	if i+1 < len(units) && scaled*units[i].size >= units[i+1].size {
+		i++
+		scaled, decimals = compactScale(abs, units[i].size)
+	}
+
+	s := strings.TrimSuffix(Number(scaled, decimals), ".0") + " " + units[i].name
+	if v < 0 {
+		return "-" + s
+	}
+	return s
+}
+
+// compactScale is abs in units of size, rounded to the decimals Compact shows:
+// one is plenty for small multiples, beyond that it is noise
+func compactScale(abs, size float64) (float64, int) {
+	scaled := abs / size
+	decimals := 1
+	if scaled >= 100 {
+		decimals = 0
+	}
+	pow := math.Pow10(decimals)
+	return math.Round(scaled*pow) / pow, decimals
+}
+
+// CompactRupee is Compact for an amount in rupees: "₹2.3 L Cr"
+func CompactRupee(v float64) string {
+	s := Compact(math.Abs(v))
+	if math.Round(math.Abs(v)) < lakh {
+		s = Number(math.Abs(v), 2)
+	}
+	return withSign(v, 2, "", rupeeSymbol+s)
+}
+
+// group inserts commas into a string of digits: the last three, then every two
+func group(digits string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	head, tail := digits[:len(digits)-3], digits[len(digits)-3:]
+
+	var parts []string
+	for len(head) > 2 {
+		parts = append([]string{head[len(head)-2:]}, parts...)
+		head = head[:len(head)-2]
+	}
+	parts = append([]string{head}, parts...)
+	return strings.Join(parts, ",") + "," + tail
+}
+
+// withSign prefixes s with "-" for negative v, or positive for positive v.
+// Values that round to zero at decimals get no sign.
+func withSign(v float64, decimals int, positive, s string) string {
+	switch {
+	case isNegative(v, decimals):
+		return "-" + s
+	case isZero(v, decimals):
+		return s
+	default:
+		return positive + s
+	}
+}
+
+func isZero(v float64, decimals int) bool {
+	return math.Abs(v) < 0.5*math.Pow10(-decimals)
+}
+
+func isNegative(v float64, decimals int) bool {
+	return v < 0 && !isZero(v, decimals)
+}
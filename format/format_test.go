@@ -0,0 +1,124 @@
+package format
+
+import "testing"
+
+func TestGroup(t *testing.T) {
+	tests := map[string]string{
+		"":              "",
+		"5":             "5",
+		"999":           "999",
+		"1000":          "1,000",
+		"99999":         "99,999",
+		"100000":        "1,00,000",
+		"1234567":       "12,34,567",
+		"123456789":     "12,34,56,789",
+		"1000000000000": "10,00,00,00,00,000",
+	}
+	for digits, want := range tests {
+		if got := group(digits); got != want {
+			t.Errorf("group(%q) = %q, want %q", digits, got, want)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		v        float64
+		decimals int
+		want     string
+	}{
+		{0, 2, "0.00"},
+		{125000.5, 2, "1,25,000.50"},
+		{-125000.5, 2, "-1,25,000.50"},
+		{1234567, 0, "12,34,567"},
+		{999.996, 2, "1,000.00"},
+		{-0.004, 2, "0.00"}, // rounds to zero, so no minus sign
+		{-0.4, 0, "0"},
+	}
+	for _, tt := range tests {
+		if got := Number(tt.v, tt.decimals); got != tt.want {
+			t.Errorf("Number(%v, %d) = %q, want %q", tt.v, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestSigns(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(float64) string
+		v    float64
+		want string
+	}{
+		{"Rupee", Rupee, 125000.5, "₹1,25,000.50"},
+		{"Rupee", Rupee, -50, "-₹50.00"},
+		{"Rupee", Rupee, -0.001, "₹0.00"},
+		{"SignedRupee", SignedRupee, 12.5, "+₹12.50"},
+		{"SignedRupee", SignedRupee, -12.5, "-₹12.50"},
+		{"SignedRupee", SignedRupee, 0, "₹0.00"},
+		{"SignedRupee", SignedRupee, 0.004, "₹0.00"},
+		{"SignedPoints", SignedPoints, 112.4, "+112.40"},
+		{"SignedPoints", SignedPoints, -1234.5, "-1,234.50"},
+		{"Percent", Percent, -3.456, "-3.46%"},
+		{"SignedPercent", SignedPercent, 1.2, "+1.20%"},
+		{"SignedPercent", SignedPercent, -0.001, "0.00%"},
+		{"Quantity", Quantity, 1200, "1,200"},
+		{"Quantity", Quantity, 0.5, "0.5"},
+		{"Quantity", Quantity, 2.12345, "2.1235"},
+	}
+	for _, tt := range tests {
+		if got := tt.fn(tt.v); got != tt.want {
+			t.Errorf("%s(%v) = %q, want %q", tt.name, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{0, "0"},
+		{99999, "99,999"},
+		{99999.6, "1 L"},
+		{100000, "1 L"},
+		{125000, "1.3 L"},
+		{-125000, "-1.3 L"},
+		{9994000, "99.9 L"},
+		{9999999, "1 Cr"},
+		{10000000, "1 Cr"},
+		{123456789, "12.3 Cr"},
+		{1234567890, "123 Cr"},
+		{999999999999, "1 L Cr"},
+		{2.3e12, "2.3 L Cr"},
+		{1.5e15, "1,500 L Cr"},
+	}
+	for _, tt := range tests {
+		if got := Compact(tt.v); got != tt.want {
+			t.Errorf("Compact(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestCompactRupee(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{99999.4, "₹99,999.40"},
+		{9999999, "₹1 Cr"},
+		{-2.3e12, "-₹2.3 L Cr"},
+	}
+	for _, tt := range tests {
+		if got := CompactRupee(tt.v); got != tt.want {
+			t.Errorf("CompactRupee(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestFinancialYear(t *testing.T) {
+	for start, want := range map[int]string{2025: "FY2025-26", 2099: "FY2099-00"} {
+		if got := FinancialYear(start); got != want {
+			t.Errorf("FinancialYear(%d) = %q, want %q", start, got, want)
+		}
+	}
+}
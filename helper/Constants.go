@@ -1,35 +1,27 @@
 package helper
 
-type EnvironmentConstants struct {
-	DB_URL             string
-	GIN_MODE           string
-	TWILIO_ACCOUNT_SID string
-	TWILIO_AUTH_TOKEN  string
-	PHONE_NUMBER       string
-	STOCK_PRICE_URL    string
-	PORT               string
-}
-
-func EnvironmentConstant() EnvironmentConstants {
-	return EnvironmentConstants{
-		DB_URL:             "DB_URL",
-		GIN_MODE:           "GIN_MODE",
-		TWILIO_AUTH_TOKEN:  "TWILIO_AUTH_TOKEN",
-		TWILIO_ACCOUNT_SID: "TWILIO_ACCOUNT_SID",
-		PHONE_NUMBER:       "PHONE_NUMBER",
-		STOCK_PRICE_URL:    "STOCK_PRICE_URL",
-		PORT:               "PORT",
-	}
-}
+import "time"
 
 type AppConstants struct {
-	WhatsApp    string
-	DefaultPort string
+	WhatsApp         string
+	MaxMessageLength int
+	MaxQuickReplies  int
+	MaxListItems     int
+	MaxCompareStocks int
+	MaxImportBytes   int64 // largest broker export we'll download
+	SessionWindow    time.Duration
+	Horizons         []string // every performance horizon, in display order
 }
 
 func AppConstant() AppConstants {
 	return AppConstants{
-		WhatsApp:    "whatsapp:",
-		DefaultPort: "8080",
+		WhatsApp:         "whatsapp:",
+		MaxMessageLength: 1600,
+		MaxQuickReplies:  3,
+		MaxListItems:     10,
+		MaxCompareStocks: 4,
+		MaxImportBytes:   2 << 20,
+		SessionWindow:    24 * time.Hour,
+		Horizons:         []string{"1W", "1M", "3M", "6M", "YTD", "1Y", "3Y", "5Y"},
 	}
 }
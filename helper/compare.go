@@ -0,0 +1,118 @@
+package helper
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"stocks-info-channel/format"
+	"stocks-info-channel/i18n"
+	"stocks-info-channel/model"
+)
+
+// maxCompareSymbolLength keeps comparison columns narrow enough for a phone
+const maxCompareSymbolLength = 10
+
+// compareMetric is one row of a comparison table
+type compareMetric struct {
+	label  string
+	value  func(model.StockPerformance) (float64, bool)
+	format func(float64) string
+	rank   bool // mark the highest value as the winner
+}
+
+// compareMetrics are the rows of a comparison, in order
+func compareMetrics(locale string) []compareMetric {
+	metrics := []compareMetric{
+		{
+			label:  i18n.T(locale, "compare.price"),
+			value:  func(s model.StockPerformance) (float64, bool) { return s.Current, true },
+			format: format.Points,
+		},
+		{
+			label:  i18n.T(locale, "compare.day"),
+			value:  func(s model.StockPerformance) (float64, bool) { return Growth(s.Open, s.Current), s.Open > 0 },
+			format: format.SignedPercent,
+			rank:   true,
+		},
+	}
+	for _, horizon := range []string{"1M", "1Y", "5Y"} {
+		metrics = append(metrics, compareMetric{
+			label: horizon,
+			value: func(s model.StockPerformance) (float64, bool) {
+				entry, ok := s.Entries[horizon]
+				return entry.Growth, ok
+			},
+			format: format.SignedPercent,
+			rank:   true,
+		})
+	}
+	return append(metrics, compareMetric{
+		label: i18n.T(locale, "compare.cagr"),
+		value: func(s model.StockPerformance) (float64, bool) {
+			entry, ok := s.Entries["5Y"]
+			return entry.CAGR, ok && entry.Years >= 1
+		},
+		format: format.SignedPercent,
+		rank:   true,
+	})
+}
+
+// comparisonTable lays stocks out side by side for a monospace block, with
+// the winner of each row starred
+func comparisonTable(locale string, stocks []model.StockPerformance) string {
+	header := []string{""}
+	for _, stock := range stocks {
+		header = append(header, truncate(stock.Symbol, maxCompareSymbolLength)+" ")
+	}
+	rows := [][]string{header}
+
+	for _, metric := range compareMetrics(locale) {
+		values := make([]float64, len(stocks))
+		known := make([]bool, len(stocks))
+		best, ranked := 0.0, 0
+		for i, stock := range stocks {
+			values[i], known[i] = metric.value(stock)
+			if known[i] && (ranked == 0 || values[i] > best) {
+				best = values[i]
+			}
+			if known[i] {
+				ranked++
+			}
+		}
+
+		row := []string{metric.label}
+		for i := range stocks {
+			switch {
+			case !known[i]:
+				row = append(row, "– ")
+			case metric.rank && ranked > 1 && values[i] == best:
+				row = append(row, metric.format(values[i])+"★")
+			default:
+				row = append(row, metric.format(values[i])+" ")
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		var sb strings.Builder
+		for i, cell := range row {
+			padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if i == 0 {
+				sb.WriteString(cell + padding)
+			} else {
+				sb.WriteString(" " + padding + cell)
+			}
+		}
+		lines = append(lines, strings.TrimRight(sb.String(), " "))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -1,132 +1,168 @@
 package helper
 
 import (
-	"fmt"
+	"math"
+	"time"
+
+	"stocks-info-channel/i18n"
 	"stocks-info-channel/model"
-	"strings"
 )
 
-func WelcomeMessage() string {
-	return `👋🏻 Welcome to *Stocks Info Channel*!
+func WelcomeMessage(locale string) string {
+	return render(locale, "welcome", nil)
+}
 
-You can send:
-• 🔍 *Stock RELIANCE* — Get the latest *RELIANCE (Reliance Industries Ltd)* stock price
-• ⭐ *Top Stocks* — Today's trending stocks *(coming soon 🚧)*
-• 📢 *Alert NIFTY* — Set a stock price alert
+func NoStockFoundMessage(locale string) string {
+	return render(locale, "no_stock_found", nil)
+}
 
-Made with ❤️ in 🇮🇳`
+func StockNotInDatabaseMessage(locale string) string {
+	return render(locale, "stock_not_in_database", nil)
 }
 
-func NoStockFoundMessage() string {
-	return `❌ No matching stock found.
-💡 Try using the full company name or its stock symbol (e.g., INFY, TCS, RELIANCE).`
+func PriceServiceUnavailableMessage(locale string) string {
+	return render(locale, "price_service_unavailable", nil)
 }
 
-func StockNotInDatabaseMessage() string {
-	return `⚠️ We couldn’t find this stock.
-It might be missing from our database or not yet updated.
+// SlowDownMessage tells a throttled user how long until they can send again,
+// in seconds (rounded up to 5) under two minutes and in minutes beyond
+func SlowDownMessage(locale string, wait time.Duration) string {
+	data := struct{ Seconds, Minutes int }{}
+	if wait < 2*time.Minute {
+		data.Seconds = max(5, int(math.Ceil(wait.Seconds()/5))*5)
+	} else {
+		data.Minutes = int(math.Ceil(wait.Minutes()))
+	}
+	return render(locale, "slow_down", data)
+}
 
-📢 We’ll add it soon and let you know when it’s available.`
+func UnknownIndexMessage(locale string, names []string) string {
+	return render(locale, "unknown_index", names)
 }
 
-func GenerateCompanyMessage(stocks []model.Stock) string {
-	var sb strings.Builder
+func GenerateCompanyMessage(locale string, stocks []model.Stock) string {
+	return render(locale, "company_choices", stocks)
+}
 
-	sb.WriteString("📈 *Multiple companies matched your query:*\n\n")
+func SingleStockPerformanceMessage(locale string, stock model.StockPerformance) string {
+	return render(locale, "stock_performance", stock)
+}
 
-	for i, s := range stocks {
-		sb.WriteString(fmt.Sprintf("%d. *%s*\n    *(%s)*\n\n", i+1, s.CompanyName, s.Symbol))
-	}
+// GrowthMessage is the shorter performance update used for automated alerts
+func GrowthMessage(locale string, stock model.StockPerformance) string {
+	return render(locale, "growth", stock)
+}
 
-	sb.WriteString("🔁 Please reply with the *number* (e.g., 1 or 2) to choose.")
+func AlertStockMessage(locale, symbol string, price float64) string {
+	return render(locale, "alert_stock", struct {
+		Symbol string
+		Price  float64
+	}{symbol, price})
+}
 
-	return sb.String()
+// LanguageSetMessage confirms, in the new language, that replies will use locale
+func LanguageSetMessage(locale string) string {
+	return render(locale, "language_set", nil)
 }
 
-func SingleStockPerformanceMessage(stock model.StockPerformance) string {
-	var sb strings.Builder
+// LanguageUnknownMessage lists the languages a user can pick from
+func LanguageUnknownMessage(locale string) string {
+	return render(locale, "language_unknown", i18n.Supported())
+}
 
-	// Daily change
-	change := stock.Current - stock.Open
-	var percentChange float64
-	if stock.Open != 0 {
-		percentChange = (change / stock.Open) * 100
-	}
+// CompareMessage shows stocks side by side. unmatched are the names that
+// matched no single stock and unpriced the ones that couldn't be quoted.
+func CompareMessage(locale string, stocks []model.StockPerformance, unmatched, unpriced []string) string {
+	return render(locale, "compare", struct {
+		Table     string
+		Unmatched []string
+		Unpriced  []string
+	}{comparisonTable(locale, stocks), unmatched, unpriced})
+}
 
-	var dailyTrendEmoji string
-	switch {
-	case change > 0:
-		dailyTrendEmoji = "📈🟢"
-	case change < 0:
-		dailyTrendEmoji = "📉🔴"
-	default:
-		dailyTrendEmoji = "⏸️"
-	}
+// CompareUsageMessage explains the compare command, which takes up to max stocks
+func CompareUsageMessage(locale string, max int) string {
+	return render(locale, "compare_usage", max)
+}
 
-	// Header
-	sb.WriteString(fmt.Sprintf(
-		"%s *%s (%s)*\n\n", dailyTrendEmoji, stock.CompanyName, stock.Symbol,
-	))
-
-	// Current & open price
-	sb.WriteString(fmt.Sprintf(
-		"💰 *Current Price*: ₹%.2f\n🔓 *Opened At*: ₹%.2f\n📊 *Today's Change*: ₹%.2f (%.2f%%)\n",
-		stock.Current, stock.Open, change, percentChange,
-	))
-
-	// Timestamp
-	sb.WriteString(fmt.Sprintf(
-		"🕒 *As of*: %s\n\n", stock.Timestamp.Format("02 Jan 2006 03:04 PM"),
-	))
-
-	// Performance overview
-	sb.WriteString("📈 *Performance Overview:*\n")
-
-	for _, label := range []string{"1M", "1Y", "5Y"} {
-		entry, ok := stock.Entries[label]
-		if !ok {
-			continue
-		}
-
-		emoji := "📈"
-		trend := "gain"
-		if entry.Growth < 0 {
-			emoji = "📉"
-			trend = "loss"
-		} else if entry.Growth == 0 {
-			emoji = "⚖️"
-			trend = "no change"
-		}
-
-		comment := ""
-		switch {
-		case entry.Growth > 100:
-			comment = "🚀 Massive rally!"
-		case entry.Growth > 50:
-			comment = "🔥 Strong performer!"
-		case entry.Growth > 10:
-			comment = "👍 Decent growth"
-		case entry.Growth > 0:
-			comment = "📊 Mild uptick"
-		case entry.Growth > -10:
-			comment = "🔻 Slight dip"
-		case entry.Growth > -50:
-			comment = "⚠️ Weak trend"
-		default:
-			comment = "💥 Major crash!"
-		}
-
-		sb.WriteString(fmt.Sprintf(
-			"%s *%s*: %.2f%% %s (₹%.2f → ₹%.2f) %s\n",
-			emoji, label, entry.Growth, trend, entry.FromPrice, entry.ToPrice, comment,
-		))
-	}
+// TradeRecordedMessage confirms a recorded buy or sell
+func TradeRecordedMessage(locale string, transaction model.Transaction) string {
+	return render(locale, "trade_recorded", transaction)
+}
 
-	sb.WriteString("\n📬 _This is an automated stock alert. Stay informed!_")
+// TradeUsageMessage explains how to record a buy or sell
+func TradeUsageMessage(locale string) string {
+	return render(locale, "trade_usage", nil)
+}
+
+// TradeAmbiguousMessage asks for the exact symbol when query matched several companies
+func TradeAmbiguousMessage(locale, query string) string {
+	return render(locale, "trade_ambiguous", query)
+}
+
+// OversoldMessage refuses a sale of more shares than the user held
+func OversoldMessage(locale, symbol string, held, selling float64) string {
+	return render(locale, "trade_oversold", struct {
+		Symbol  string
+		Held    float64
+		Selling float64
+	}{symbol, held, selling})
+}
+
+// PortfolioMessage lists the user's holdings with their P&L and totals
+func PortfolioMessage(locale string, portfolio model.Portfolio) string {
+	return render(locale, "portfolio", portfolio)
+}
+
+// importPreviewRows is how many rows of an import are shown before it is confirmed
+const importPreviewRows = 10
+
+// ImportPreviewMessage shows what a broker export will add and asks the user to confirm it
+func ImportPreviewMessage(locale string, pending model.PendingImport) string {
+	preview := pending.Transactions[:min(len(pending.Transactions), importPreviewRows)]
+	skipped := pending.Skipped[:min(len(pending.Skipped), importPreviewRows)]
+	return render(locale, "import_preview", struct {
+		model.PendingImport
+		Preview      []model.Transaction
+		More         int
+		ShownSkipped []string
+		MoreSkipped  int
+	}{pending, preview, len(pending.Transactions) - len(preview), skipped, len(pending.Skipped) - len(skipped)})
+}
+
+// ImportAppliedMessage confirms an import; recorded of total transactions were new
+func ImportAppliedMessage(locale string, recorded, total int) string {
+	return render(locale, "import_applied", struct {
+		Recorded   int
+		Duplicates int
+	}{recorded, total - recorded})
+}
+
+// ImportCancelledMessage confirms a pending import was dropped
+func ImportCancelledMessage(locale string) string {
+	return render(locale, "import_cancelled", nil)
+}
+
+// NoPendingImportMessage answers "confirm" or "cancel" when there is no import waiting
+func NoPendingImportMessage(locale string) string {
+	return render(locale, "import_none", nil)
+}
+
+// ImportUnreadableMessage is sent for attachments that aren't a broker export we know
+func ImportUnreadableMessage(locale string) string {
+	return render(locale, "import_unreadable", nil)
+}
 
-	return sb.String()
+// TaxReportMessage sums up the capital gains of a financial year; link, when
+// set, downloads the details as a CSV
+func TaxReportMessage(locale string, report model.CapitalGainsReport, link string) string {
+	return render(locale, "tax_report", struct {
+		model.CapitalGainsReport
+		Link string
+	}{report, link})
 }
 
-func AlertStockMessage(symbol string, price float64) string {
-	return fmt.Sprintf("🔔 Alert: *%s*\nCurrent Price: ₹%.2f", symbol, price)
+// TaxUsageMessage explains how to ask for a capital gains report
+func TaxUsageMessage(locale string) string {
+	return render(locale, "tax_usage", nil)
 }
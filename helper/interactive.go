@@ -0,0 +1,58 @@
+package helper
+
+import (
+	"strconv"
+	"strings"
+
+	"stocks-info-channel/model"
+)
+
+// Twilio caps the text shown on interactive elements
+const (
+	maxButtonTitleLength     = 20
+	maxListItemTitleLength   = 24
+	maxListDescriptionLength = 72
+)
+
+// ChoicePayload builds the id sent back by a button or list item, e.g. "stock:RELIANCE"
+func ChoicePayload(action, symbol string) string {
+	return action + ":" + symbol
+}
+
+// ParseChoicePayload splits a payload built by ChoicePayload back into action and symbol
+func ParseChoicePayload(payload string) (action string, symbol string, ok bool) {
+	action, symbol, ok = strings.Cut(strings.TrimSpace(payload), ":")
+	if !ok || action == "" || symbol == "" {
+		return "", "", false
+	}
+	return action, symbol, true
+}
+
+// CompanyChoiceVariables fills a Content API template for picking one of stocks.
+// Variable "1" is the prompt; each option then takes three variables in order:
+// title, payload id and description (so option one is "2", "3" and "4").
+func CompanyChoiceVariables(locale string, stocks []model.Stock, action string, quickReply bool) map[string]string {
+	titleLength := maxListItemTitleLength
+	if quickReply {
+		titleLength = maxButtonTitleLength
+	}
+
+	variables := map[string]string{
+		"1": render(locale, "choice_prompt", nil),
+	}
+	for i, s := range stocks {
+		base := 2 + i*3
+		variables[strconv.Itoa(base)] = truncate(s.Symbol, titleLength)
+		variables[strconv.Itoa(base+1)] = ChoicePayload(action, s.Symbol)
+		variables[strconv.Itoa(base+2)] = truncate(s.CompanyName, maxListDescriptionLength)
+	}
+	return variables
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
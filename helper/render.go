@@ -0,0 +1,228 @@
+package helper
+
+import (
+	"embed"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"stocks-info-channel/format"
+	"stocks-info-channel/i18n"
+	"stocks-info-channel/market"
+	"stocks-info-channel/model"
+)
+
+// templateFiles holds the default copy of every message, one file per template
+//
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// fallbackMessage is sent when a template fails, rather than an empty message
+const fallbackMessage = "⚠️ Something went wrong on our side. Please try again."
+
+var (
+	templatesMu sync.RWMutex
+	templates   = must(parseTemplates(""))
+)
+
+// templateFuncs are shared by every message template
+var templateFuncs = template.FuncMap{
+	"add":           func(a, b int) int { return a + b },
+	"sub":           func(a, b float64) float64 { return a - b },
+	"upper":         strings.ToUpper,
+	"join":          strings.Join,
+	"growth":        Growth,
+	"pct":           format.Percent,
+	"signedPct":     format.SignedPercent,
+	"rupee":         format.Rupee,
+	"signedRupee":   format.SignedRupee,
+	"qty":           format.Quantity,
+	"compact":       format.Compact,
+	"compactRupee":  format.CompactRupee,
+	"fy":            format.FinancialYear,
+	"price":         price,
+	"signedPrice":   signedPrice,
+	"ist":           market.In,
+	"timestamp":     func(t time.Time) string { return market.In(t).Format("02 Jan 2006 03:04 PM") },
+	"dayEmoji":      dayEmoji,
+	"trendEmoji":    trendEmoji,
+	"trend":         trend,
+	"growthComment": growthComment,
+	"horizons":      horizons,
+	// t and date follow the locale; each locale's templates get their own
+	"t":    func(id string) string { return i18n.T(i18n.DefaultLocale, id) },
+	"date": func(t time.Time) string { return i18n.Date(i18n.DefaultLocale, market.In(t)) },
+}
+
+// LoadTemplates reloads the message templates. Any *.tmpl file in dir
+// replaces the embedded template with the same name, so copy can be changed
+// without a rebuild; an empty dir restores the embedded templates.
+func LoadTemplates(dir string) error {
+	t, err := parseTemplates(dir)
+	if err != nil {
+		return err
+	}
+	templatesMu.Lock()
+	templates = t
+	templatesMu.Unlock()
+	return nil
+}
+
+// parseTemplates parses the templates once and clones them for every
+// supported locale, with t and date bound to that locale's catalog
+func parseTemplates(dir string) (map[string]*template.Template, error) {
+	t, err := template.New("messages").Funcs(templateFuncs).ParseFS(templateFiles, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		overrides, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		if len(overrides) > 0 {
+			if t, err = t.ParseFiles(overrides...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	byLocale := make(map[string]*template.Template)
+	for _, catalog := range i18n.Supported() {
+		clone, err := t.Clone()
+		if err != nil {
+			return nil, err
+		}
+		locale := catalog.Locale
+		byLocale[locale] = clone.Funcs(template.FuncMap{
+			"t":    func(id string) string { return i18n.T(locale, id) },
+			"date": func(t time.Time) string { return i18n.Date(locale, market.In(t)) },
+		})
+	}
+	return byLocale, nil
+}
+
+func must(t map[string]*template.Template, err error) map[string]*template.Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render executes the template called name (its file name without .tmpl) in
+// locale, or in English when locale has no catalog
+func Render(locale, name string, data any) (string, error) {
+	templatesMu.RLock()
+	t := templates[i18n.Normalize(locale)]
+	templatesMu.RUnlock()
+
+	var sb strings.Builder
+	if err := t.ExecuteTemplate(&sb, name+".tmpl", data); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// render is Render for the message helpers, which can't return an error
+func render(locale, name string, data any) string {
+	msg, err := Render(locale, name, data)
+	if err != nil {
+		slog.Error("failed to render message template", "template", name, "locale", locale, "error", err)
+		return fallbackMessage
+	}
+	return msg
+}
+
+// price shows a rupee amount, or plain points for an index
+func price(v float64, isIndex bool) string {
+	if isIndex {
+		return format.Points(v)
+	}
+	return format.Rupee(v)
+}
+
+// signedPrice is price for a change, with an explicit sign
+func signedPrice(v float64, isIndex bool) string {
+	if isIndex {
+		return format.SignedPoints(v)
+	}
+	return format.SignedRupee(v)
+}
+
+func dayEmoji(change float64) string {
+	switch {
+	case change > 0:
+		return "📈🟢"
+	case change < 0:
+		return "📉🔴"
+	default:
+		return "⏸️"
+	}
+}
+
+func trendEmoji(growth float64) string {
+	switch {
+	case growth < 0:
+		return "📉"
+	case growth == 0:
+		return "⚖️"
+	default:
+		return "📈"
+	}
+}
+
+// trend is the message ID describing the direction of growth
+func trend(growth float64) string {
+	switch {
+	case growth < 0:
+		return "trend.loss"
+	case growth == 0:
+		return "trend.no_change"
+	default:
+		return "trend.gain"
+	}
+}
+
+// growthComment is the message ID of the remark on a horizon's growth
+func growthComment(growth float64) string {
+	switch {
+	case growth > 100:
+		return "comment.massive_rally"
+	case growth > 50:
+		return "comment.strong"
+	case growth > 10:
+		return "comment.decent"
+	case growth > 0:
+		return "comment.mild"
+	case growth > -10:
+		return "comment.slight_dip"
+	case growth > -50:
+		return "comment.weak"
+	default:
+		return "comment.crash"
+	}
+}
+
+// horizonEntry is one line of the performance overview
+type horizonEntry struct {
+	Label string
+	model.HistoricalEntry
+}
+
+// horizons lists entries in the order given, or in the standard order of
+// AppConstant().Horizons when there is none
+func horizons(entries map[string]model.HistoricalEntry, order []string) []horizonEntry {
+	if len(order) == 0 {
+		order = AppConstant().Horizons
+	}
+	var list []horizonEntry
+	for _, label := range order {
+		if entry, ok := entries[label]; ok {
+			list = append(list, horizonEntry{Label: label, HistoricalEntry: entry})
+		}
+	}
+	return list
+}
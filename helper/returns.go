@@ -0,0 +1,42 @@
+package helper
+
+import "math"
+
+// Growth is the percentage change from one price to another
+func Growth(from, to float64) float64 {
+	if from == 0 {
+		return 0
+	}
+	return ((to - from) / from) * 100
+}
+
+// CAGR is the compound annual growth rate, in percent, of going from one
+// price to another over years. It is 0 when it can't be computed.
+func CAGR(from, to, years float64) float64 {
+	if from <= 0 || to <= 0 || years <= 0 {
+		return 0
+	}
+	return (math.Pow(to/from, 1/years) - 1) * 100
+}
+
+// HorizonYears is the length of a fixed performance horizon in years, or 0
+// for horizons like YTD whose length depends on the date
+func HorizonYears(horizon string) float64 {
+	switch horizon {
+	case "1W":
+		return 7.0 / 365
+	case "1M":
+		return 1.0 / 12
+	case "3M":
+		return 3.0 / 12
+	case "6M":
+		return 6.0 / 12
+	case "1Y":
+		return 1
+	case "3Y":
+		return 3
+	case "5Y":
+		return 5
+	}
+	return 0
+}
@@ -0,0 +1,250 @@
+package helper
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// markupMarkers are the WhatsApp inline styles that must be opened and closed within one part
+const markupMarkers = "*_~"
+
+// SplitMessage breaks body into ordered parts no longer than limit characters.
+// Parts are cut on section (blank line) or line boundaries where possible and
+// numbered like "(1/3)". A message that already fits is returned untouched.
+func SplitMessage(body string, limit int) []string {
+	if MessageLength(body) <= limit {
+		return []string{body}
+	}
+
+	// Reserve room for the "(n/m)\n" label, widening it until the part count fits
+	for digits := 1; ; digits++ {
+		reserve := 2*digits + 4
+		parts := splitIntoChunks(body, limit-reserve)
+		if len(parts) < pow10(digits) {
+			for i, part := range parts {
+				parts[i] = fmt.Sprintf("(%d/%d)\n%s", i+1, len(parts), part)
+			}
+			return parts
+		}
+	}
+}
+
+// MessageLength counts characters the way Twilio does (UTF-16 code units)
+func MessageLength(s string) int {
+	n := 0
+	for _, r := range s {
+		if l := utf16.RuneLen(r); l > 0 {
+			n += l
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// splitIntoChunks greedily packs lines into chunks of at most max characters
+func splitIntoChunks(body string, max int) []string {
+	var parts []string
+	var current []string
+
+	emit := func(lines []string) {
+		chunk := strings.Trim(strings.Join(lines, "\n"), "\n")
+		if strings.TrimSpace(chunk) != "" {
+			parts = append(parts, chunk)
+		}
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		// A single line that cannot fit anywhere is cut on word boundaries
+		for MessageLength(line) > max {
+			emit(current)
+			current = nil
+			head, rest := splitLongLine(line, max)
+			parts = append(parts, head)
+			line = rest
+		}
+
+		for len(current) > 0 && MessageLength(strings.Join(current, "\n"))+1+MessageLength(line) > max {
+			// Prefer breaking at the last section boundary so related lines stay together
+			cut := lastBlankLine(current)
+			if cut <= 0 {
+				cut = len(current)
+			}
+			emit(current[:cut])
+			current = current[cut:]
+			for len(current) > 0 && strings.TrimSpace(current[0]) == "" {
+				current = current[1:]
+			}
+		}
+		current = append(current, line)
+	}
+	emit(current)
+
+	return parts
+}
+
+// lastBlankLine returns the index of the last empty line, or -1
+func lastBlankLine(lines []string) int {
+	for i := len(lines) - 1; i > 0; i-- {
+		if strings.TrimSpace(lines[i]) == "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitLongLine cuts a line so the head fits within max characters. It never
+// splits a grapheme cluster and closes any markup left open in the head,
+// reopening it at the start of the rest.
+func splitLongLine(line string, max int) (string, string) {
+	// Keep room for closing markers we may need to append
+	budget := max - len(markupMarkers)
+
+	var (
+		length       int
+		lastBoundary int // byte offset of the last grapheme boundary that fits
+		lastSpace    = -1
+		balanceSpace = -1 // last space where no markup is open
+		open         = map[rune]bool{}
+	)
+
+	for pos := 0; pos < len(line); {
+		size := graphemeLength(line[pos:])
+		cluster := line[pos : pos+size]
+		length += MessageLength(cluster)
+		if length > budget {
+			break
+		}
+		if cluster == " " {
+			lastSpace = pos
+			if !anyOpen(open) {
+				balanceSpace = pos
+			}
+		} else if strings.Contains(markupMarkers, cluster) && isMarkup(line, pos) {
+			r := rune(cluster[0])
+			open[r] = !open[r]
+		}
+		pos += size
+		lastBoundary = pos
+	}
+
+	cut := lastBoundary
+	switch {
+	case balanceSpace > 0:
+		cut = balanceSpace
+	case lastSpace > 0:
+		cut = lastSpace
+	}
+	if cut == 0 {
+		// Degenerate case: the first cluster alone exceeds the budget
+		cut = graphemeLength(line)
+	}
+
+	head, rest := line[:cut], strings.TrimLeft(line[cut:], " ")
+
+	// Close markup left open in the head and reopen it in the rest
+	var closing string
+	for _, marker := range markupMarkers {
+		count := 0
+		for i := 0; i < len(head); i++ {
+			if rune(head[i]) == marker && isMarkup(line, i) {
+				count++
+			}
+		}
+		if count%2 == 1 {
+			closing += string(marker)
+		}
+	}
+	if closing != "" {
+		head = strings.TrimRight(head, " ") + reverse(closing)
+		rest = closing + rest
+	}
+
+	return head, rest
+}
+
+// graphemeLength returns the byte length of the first user-perceived character in s,
+// keeping emoji ZWJ sequences, skin tones, flags, keycaps and combining marks together
+func graphemeLength(s string) int {
+	r, size := utf8.DecodeRuneInString(s)
+	pos := size
+
+	if isRegionalIndicator(r) {
+		if next, nsize := utf8.DecodeRuneInString(s[pos:]); isRegionalIndicator(next) {
+			return pos + nsize
+		}
+		return pos
+	}
+
+	for pos < len(s) {
+		next, nsize := utf8.DecodeRuneInString(s[pos:])
+		switch {
+		case next == '\u200d': // zero width joiner glues the following rune
+			pos += nsize
+			if pos < len(s) {
+				_, jsize := utf8.DecodeRuneInString(s[pos:])
+				pos += jsize
+			}
+		case unicode.Is(unicode.Mn, next), unicode.Is(unicode.Me, next), unicode.Is(unicode.Mc, next),
+			next >= 0xFE00 && next <= 0xFE0F,   // variation selectors
+			next >= 0x1F3FB && next <= 0x1F3FF, // skin tone modifiers
+			next >= 0xE0020 && next <= 0xE007F: // tag sequences
+			pos += nsize
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
+// isMarkup reports whether the marker at byte offset i of s styles text, as
+// WhatsApp only honours markers on a word boundary: the "_" in HDFC_BANK or a
+// URL is literal, as is a marker standing alone between spaces
+func isMarkup(s string, i int) bool {
+	before, _ := utf8.DecodeLastRuneInString(s[:i])
+	after, _ := utf8.DecodeRuneInString(s[i+1:])
+	if isWordRune(before) && isWordRune(after) {
+		return false
+	}
+	return !(isSpaceOrEdge(before) && isSpaceOrEdge(after))
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isSpaceOrEdge(r rune) bool {
+	return r == utf8.RuneError || unicode.IsSpace(r)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+func anyOpen(open map[rune]bool) bool {
+	for _, v := range open {
+		if v {
+			return true
+		}
+	}
+	return false
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func pow10(n int) int {
+	p := 1
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
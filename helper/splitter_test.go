@@ -0,0 +1,101 @@
+package helper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMessageLength(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"TCS", 3},
+		{"₹1,250", 6},
+		{"शेयर", 4},
+		{"📈", 2},     // outside the BMP: a surrogate pair
+		{"👨‍👩‍👧", 8}, // three emoji joined by two ZWJs
+	}
+	for _, tt := range tests {
+		if got := MessageLength(tt.s); got != tt.want {
+			t.Errorf("MessageLength(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+var partLabel = regexp.MustCompile(`^\((\d+)/(\d+)\)\n`)
+
+func TestSplitMessage(t *testing.T) {
+	var sections []string
+	for i := 1; i <= 12; i++ {
+		sections = append(sections, fmt.Sprintf("*Section %d*\nline one of section %d\nline two of section %d", i, i, i))
+	}
+	longLine := strings.Repeat("word ", 60) + "*bold text that runs across the cut* " + strings.Repeat("tail ", 20)
+	emoji := strings.Repeat("👨‍👩‍👧 ", 30)
+
+	tests := []struct {
+		name      string
+		body      string
+		limit     int
+		wantParts int // 0 to only check the invariants
+	}{
+		{name: "short message is untouched", body: "Hello *there*", limit: 100, wantParts: 1},
+		{name: "sections", body: strings.Join(sections, "\n\n"), limit: 200},
+		{name: "long line", body: longLine, limit: 120},
+		{name: "emoji sequences", body: emoji, limit: 50},
+		{name: "snake case and URLs aren't markup", body: strings.Repeat("HDFC_BANK and https://example.com/q?s=tata_motors_dvr ", 8), limit: 60},
+		{name: "many parts widen the label", body: strings.Repeat("0123456789 ", 200), limit: 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := SplitMessage(tt.body, tt.limit)
+			if tt.wantParts != 0 && len(parts) != tt.wantParts {
+				t.Fatalf("got %d parts, want %d", len(parts), tt.wantParts)
+			}
+			if len(parts) == 1 {
+				if parts[0] != tt.body {
+					t.Errorf("single part = %q, want the body untouched", parts[0])
+				}
+				return
+			}
+
+			var words []string
+			for i, part := range parts {
+				if n := MessageLength(part); n > tt.limit {
+					t.Errorf("part %d is %d characters, over the limit of %d", i+1, n, tt.limit)
+				}
+				label := partLabel.FindStringSubmatch(part)
+				if label == nil || label[1] != fmt.Sprint(i+1) || label[2] != fmt.Sprint(len(parts)) {
+					t.Fatalf("part %d is labelled %q, want (%d/%d)", i+1, part[:min(len(part), 8)], i+1, len(parts))
+				}
+				text := strings.TrimPrefix(part, label[0])
+				if strings.Count(text, "*")%2 != 0 {
+					t.Errorf("part %d leaves bold markup open: %q", i+1, text)
+				}
+				words = append(words, strings.Fields(strings.ReplaceAll(text, "*", " "))...)
+			}
+
+			// Nothing is lost or reordered, and no emoji sequence is broken
+			want := strings.Fields(strings.ReplaceAll(tt.body, "*", " "))
+			if strings.Join(words, " ") != strings.Join(want, " ") {
+				t.Errorf("parts don't add up to the body:\n got %q\nwant %q", words, want)
+			}
+		})
+	}
+}
+
+func TestSplitMessagePrefersSectionBreaks(t *testing.T) {
+	first := "*TCS*\n" + strings.Repeat("a", 40)
+	second := "*INFY*\n" + strings.Repeat("b", 40)
+	parts := SplitMessage(first+"\n\n"+second, 70)
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2: %q", len(parts), parts)
+	}
+	if parts[0] != "(1/2)\n"+first || parts[1] != "(2/2)\n"+second {
+		t.Errorf("parts = %q, want one section each", parts)
+	}
+}
@@ -0,0 +1,190 @@
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultLocale is used for users who haven't picked a language and whose
+// messages don't give one away
+const DefaultLocale = "en"
+
+// Canonical commands, whatever language they were typed in
+const (
+	CommandStock     = "stock"
+	CommandAlert     = "alert"
+	CommandIndex     = "index"
+	CommandLanguage  = "language"
+	CommandTopStocks = "top_stocks"
+	CommandCompare   = "compare"
+	CommandBuy       = "buy"
+	CommandSell      = "sell"
+	CommandPortfolio = "portfolio"
+	CommandConfirm   = "confirm"
+	CommandCancel    = "cancel"
+	CommandTax       = "tax"
+)
+
+//go:embed locales/*.yaml
+var localeFiles embed.FS
+
+// Catalog is one language's copy, keyed by message ID, and the words its
+// speakers use for our commands
+type Catalog struct {
+	Locale      string              `yaml:"-"`
+	Name        string              `yaml:"name"`         // in the language itself, e.g. हिन्दी
+	EnglishName string              `yaml:"english_name"` // e.g. Hindi
+	Aliases     []string            `yaml:"aliases"`      // names users type to pick the language
+	Commands    map[string][]string `yaml:"commands"`
+	Messages    map[string]string   `yaml:"messages"`
+	Weekdays    []string            `yaml:"weekdays"` // short names, Sunday first
+	Months      []string            `yaml:"months"`   // short names, January first
+}
+
+var catalogs = mustLoadCatalogs()
+
+func mustLoadCatalogs() map[string]*Catalog {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := make(map[string]*Catalog)
+	for _, file := range files {
+		data, err := localeFiles.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var catalog Catalog
+		if err := yaml.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("locale %s: %v", file.Name(), err))
+		}
+		catalog.Locale = strings.TrimSuffix(file.Name(), ".yaml")
+		if len(catalog.Weekdays) != 7 || len(catalog.Months) != 12 {
+			panic(fmt.Sprintf("locale %s: need 7 weekdays and 12 months", file.Name()))
+		}
+		loaded[catalog.Locale] = &catalog
+	}
+	if loaded[DefaultLocale] == nil {
+		panic("missing catalog for default locale " + DefaultLocale)
+	}
+	return loaded
+}
+
+// Supported lists every catalog, English first
+func Supported() []*Catalog {
+	list := make([]*Catalog, 0, len(catalogs))
+	for _, catalog := range catalogs {
+		list = append(list, catalog)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Locale == DefaultLocale || list[j].Locale == DefaultLocale {
+			return list[i].Locale == DefaultLocale
+		}
+		return list[i].Locale < list[j].Locale
+	})
+	return list
+}
+
+// Normalize returns locale when we have a catalog for it, DefaultLocale otherwise
+func Normalize(locale string) string {
+	if _, ok := catalogs[locale]; ok {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// T returns message id in locale, falling back to English and then to the id itself
+func T(locale, id string) string {
+	if catalog, ok := catalogs[locale]; ok {
+		if msg, ok := catalog.Messages[id]; ok {
+			return msg
+		}
+	}
+	if msg, ok := catalogs[DefaultLocale].Messages[id]; ok {
+		return msg
+	}
+	return id
+}
+
+// Date is t's day in locale, e.g. "Fri 17 Oct". t is shown in its own timezone.
+func Date(locale string, t time.Time) string {
+	catalog, ok := catalogs[locale]
+	if !ok {
+		catalog = catalogs[DefaultLocale]
+	}
+	return catalog.Weekdays[t.Weekday()] + " " + strconv.Itoa(t.Day()) + " " + catalog.Months[t.Month()-1]
+}
+
+// ParseLanguage finds the locale a user means by name, e.g. "hindi", "हिंदी" or "hi"
+func ParseLanguage(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for locale, catalog := range catalogs {
+		if name == locale || name == strings.ToLower(catalog.EnglishName) ||
+			name == strings.ToLower(catalog.Name) || slices.Contains(catalog.Aliases, name) {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+// ParseCommand splits a message into a canonical command and its argument,
+// recognising the command words of every language, so "शेयर tcs" is
+// (CommandStock, "tcs"). The command is "" when the message starts with none.
+func ParseCommand(body string) (command, arg string) {
+	body = strings.TrimSpace(body)
+	best := ""
+	for _, catalog := range catalogs {
+		for cmd, words := range catalog.Commands {
+			for _, word := range words {
+				// Prefer the longest match so "top stocks" isn't read as "top"
+				if len(word) > len(best) && (body == word || strings.HasPrefix(body, word+" ")) {
+					command, best = cmd, word
+				}
+			}
+		}
+	}
+	if best == "" {
+		return "", body
+	}
+	return command, strings.TrimSpace(strings.TrimPrefix(body, best))
+}
+
+// DetectLocale guesses a locale from the script text is written in. Latin
+// text gives no answer since English, Hinglish and transliterated Marathi all
+// look alike.
+func DetectLocale(text string) (string, bool) {
+	var devanagari, tamil int
+	marathi := false
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Devanagari, r):
+			devanagari++
+			// ḷa is common in Marathi and all but absent from Hindi
+			marathi = marathi || r == 'ळ'
+		case unicode.Is(unicode.Tamil, r):
+			tamil++
+		}
+	}
+
+	switch {
+	case devanagari == 0 && tamil == 0:
+		return "", false
+	case tamil > devanagari:
+		return "ta", true
+	case marathi:
+		return "mr", true
+	default:
+		// Otherwise Hindi and Marathi look alike; Hindi has far more speakers
+		return "hi", true
+	}
+}
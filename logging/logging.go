@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"stocks-info-channel/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the correlation id in and out of the service
+const RequestIDHeader = "X-Request-Id"
+
+// piiKeys are attribute keys whose values identify a person, or are text the
+// user typed, and are masked by default
+var piiKeys = map[string]func(string) string{
+	"phone":    MaskPhone,
+	"from":     MaskPhone,
+	"to":       MaskPhone,
+	"body":     MaskText,
+	"query":    MaskText,
+	"language": MaskText,
+	"year":     MaskText,
+	"error":    MaskError,
+}
+
+var (
+	// phonePattern matches a phone number inside free text, e.g. a Twilio error about a recipient
+	phonePattern = regexp.MustCompile(`\+?\d{10,15}`)
+	// quotedPattern matches a quoted value, which is how lib/pq and %q errors echo input back
+	quotedPattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+)
+
+type contextKey struct{}
+
+// New builds the JSON logger described by cfg. PII masking can only be turned
+// off together with debug level, so it is never disabled by accident in production.
+func New(cfg *config.Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+
+	showPII := cfg.LogShowPII && level <= slog.LevelDebug
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if showPII {
+				return a
+			}
+			mask, ok := piiKeys[a.Key]
+			if !ok {
+				return a
+			}
+			switch v := a.Value.Any().(type) {
+			case string:
+				return slog.String(a.Key, mask(v))
+			case error:
+				return slog.String(a.Key, mask(v.Error()))
+			}
+			return a
+		},
+	})
+
+	logger := slog.New(handler)
+	if cfg.LogShowPII && !showPII {
+		logger.Warn("LOG_SHOW_PII is ignored unless LOG_LEVEL is debug")
+	}
+	if showPII {
+		logger.Warn("PII masking is disabled, phone numbers and user text will be logged")
+	}
+	return logger, nil
+}
+
+// WithLogger stores logger in ctx
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the request scoped logger, or the default one
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Middleware tags every request with a request id (taken from the X-Request-Id
+// header when present), attaches a logger carrying it to the request context
+// and logs the outcome of the request
+func Middleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		reqLogger := logger.With("request_id", requestID)
+		c.Request = c.Request.WithContext(WithLogger(c.Request.Context(), reqLogger))
+
+		c.Next()
+
+		reqLogger.Info("request handled",
+			"method", c.Request.Method,
+			"path", c.FullPath(),
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
+
+// MaskPhone keeps the country code and last four digits, e.g. +91******3210
+func MaskPhone(phone string) string {
+	if len(phone) <= 7 {
+		return strings.Repeat("*", len(phone))
+	}
+	return phone[:3] + strings.Repeat("*", len(phone)-7) + phone[len(phone)-4:]
+}
+
+// MaskText hides free text, keeping only its length
+func MaskText(text string) string {
+	return fmt.Sprintf("[redacted %d chars]", len([]rune(text)))
+}
+
+// MaskError keeps an error's message but masks phone numbers and quoted values
+// in it, which may echo back what the user typed
+func MaskError(message string) string {
+	message = quotedPattern.ReplaceAllStringFunc(message, func(quoted string) string {
+		return `"` + MaskText(quoted[1:len(quoted)-1]) + `"`
+	})
+	return phonePattern.ReplaceAllStringFunc(message, MaskPhone)
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,20 @@
+package logging
+
+import "testing"
+
+func TestMaskError(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"connection refused", "connection refused"},
+		{`pq: invalid input syntax for type numeric: "tata motors"`, `pq: invalid input syntax for type numeric: "[redacted 11 chars]"`},
+		{"The 'To' number +919876543210 is not a valid phone number", "The 'To' number +91******3210 is not a valid phone number"},
+		{`unknown date format "31/02"`, `unknown date format "[redacted 5 chars]"`},
+	}
+	for _, tt := range tests {
+		if got := MaskError(tt.message); got != tt.want {
+			t.Errorf("MaskError(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
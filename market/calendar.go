@@ -0,0 +1,184 @@
+package market
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const dateLayout = "2006-01-02"
+
+// searchDays bounds how far NextOpen and PreviousClose look; no exchange closes for longer
+const searchDays = 31
+
+// Calendar knows the trading sessions of one exchange: the normal session on
+// weekdays that aren't holidays, plus any special sessions such as Muhurat
+// trading
+type Calendar struct {
+	Version  string
+	Exchange string
+
+	open, close time.Duration        // normal session, as offsets from midnight IST
+	holidays    map[string]string    // holiday name by date
+	special     map[string][]Session // special sessions by date
+}
+
+// Session is one span of trading
+type Session struct {
+	Name  string
+	Open  time.Time
+	Close time.Time
+}
+
+// calendarFile is the on-disk form of a Calendar
+type calendarFile struct {
+	Version  string `yaml:"version"`
+	Exchange string `yaml:"exchange"`
+	Session  struct {
+		Open  string `yaml:"open"`
+		Close string `yaml:"close"`
+	} `yaml:"session"`
+	Holidays []struct {
+		Date string `yaml:"date"`
+		Name string `yaml:"name"`
+	} `yaml:"holidays"`
+	SpecialSessions []struct {
+		Date  string `yaml:"date"`
+		Name  string `yaml:"name"`
+		Open  string `yaml:"open"`
+		Close string `yaml:"close"`
+	} `yaml:"special_sessions"`
+}
+
+// ParseCalendar reads a calendar file; see calendars/nse.yaml for the format
+func ParseCalendar(data []byte) (*Calendar, error) {
+	var file calendarFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Version == "" {
+		return nil, fmt.Errorf("calendar has no version")
+	}
+
+	cal := &Calendar{
+		Version:  file.Version,
+		Exchange: file.Exchange,
+		holidays: make(map[string]string),
+		special:  make(map[string][]Session),
+	}
+	var err error
+	if cal.open, cal.close, err = parseSpan(file.Session.Open, file.Session.Close); err != nil {
+		return nil, fmt.Errorf("session: %w", err)
+	}
+
+	for _, holiday := range file.Holidays {
+		if _, err := time.Parse(dateLayout, holiday.Date); err != nil {
+			return nil, fmt.Errorf("holiday %q: %w", holiday.Name, err)
+		}
+		cal.holidays[holiday.Date] = holiday.Name
+	}
+	for _, s := range file.SpecialSessions {
+		day, err := time.ParseInLocation(dateLayout, s.Date, IST)
+		if err != nil {
+			return nil, fmt.Errorf("special session %q: %w", s.Name, err)
+		}
+		open, close, err := parseSpan(s.Open, s.Close)
+		if err != nil {
+			return nil, fmt.Errorf("special session %q: %w", s.Name, err)
+		}
+		cal.special[s.Date] = append(cal.special[s.Date], Session{Name: s.Name, Open: day.Add(open), Close: day.Add(close)})
+	}
+	return cal, nil
+}
+
+// parseSpan parses "HH:MM" open and close times as offsets from midnight
+func parseSpan(open, close string) (time.Duration, time.Duration, error) {
+	o, err := parseClock(open)
+	if err != nil {
+		return 0, 0, err
+	}
+	c, err := parseClock(close)
+	if err != nil {
+		return 0, 0, err
+	}
+	if c <= o {
+		return 0, 0, fmt.Errorf("closes at %s, before it opens at %s", close, open)
+	}
+	return o, c, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Holiday returns the name of the holiday on t's date in IST, if any
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+	name, ok := c.holidays[In(t).Format(dateLayout)]
+	return name, ok
+}
+
+// Sessions lists the sessions held on t's date in IST, in order
+func (c *Calendar) Sessions(t time.Time) []Session {
+	t = In(t)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, IST)
+	key := day.Format(dateLayout)
+
+	var sessions []Session
+	_, holiday := c.holidays[key]
+	if !holiday && day.Weekday() != time.Saturday && day.Weekday() != time.Sunday {
+		sessions = append(sessions, Session{Open: day.Add(c.open), Close: day.Add(c.close)})
+	}
+	sessions = append(sessions, c.special[key]...)
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Open.Before(sessions[j].Open) })
+	return sessions
+}
+
+// IsTradingDay reports whether any session is held on t's date in IST
+func (c *Calendar) IsTradingDay(t time.Time) bool {
+	return len(c.Sessions(t)) > 0
+}
+
+// IsOpen reports whether a session is running at t
+func (c *Calendar) IsOpen(t time.Time) bool {
+	for _, s := range c.Sessions(t) {
+		if !t.Before(s.Open) && t.Before(s.Close) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen is the start of the first session opening after t
+func (c *Calendar) NextOpen(t time.Time) time.Time {
+	day := In(t)
+	for range searchDays {
+		for _, s := range c.Sessions(day) {
+			if s.Open.After(t) {
+				return s.Open
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// PreviousClose is the end of the last session to close at or before t
+func (c *Calendar) PreviousClose(t time.Time) time.Time {
+	day := In(t)
+	for range searchDays {
+		sessions := c.Sessions(day)
+		for i := len(sessions) - 1; i >= 0; i-- {
+			if !sessions[i].Close.After(t) {
+				return sessions[i].Close
+			}
+		}
+		day = day.AddDate(0, 0, -1)
+	}
+	return time.Time{}
+}
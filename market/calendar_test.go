@@ -0,0 +1,125 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+// testCalendar has Friday 13 Nov 2026 as a holiday, so the market is shut from
+// Thursday's close until Monday, and a Muhurat session on Sunday 8 Nov
+const testCalendar = `
+version: test
+exchange: NSE
+session: {open: "09:15", close: "15:30"}
+holidays:
+  - {date: 2026-11-13, name: Diwali Balipratipada}
+special_sessions:
+  - {date: 2026-11-08, name: Muhurat Trading, open: "18:00", close: "19:00"}
+`
+
+func ist(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2026, month, day, hour, minute, 0, 0, IST)
+}
+
+func TestCalendar(t *testing.T) {
+	cal, err := ParseCalendar([]byte(testCalendar))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		at                time.Time
+		wantOpen          bool
+		wantTradingDay    bool
+		wantNextOpen      time.Time
+		wantPreviousClose time.Time
+	}{
+		{
+			name:     "Thursday during the session",
+			at:       ist(time.November, 12, 11, 0),
+			wantOpen: true, wantTradingDay: true,
+			wantNextOpen:      ist(time.November, 16, 9, 15),
+			wantPreviousClose: ist(time.November, 11, 15, 30),
+		},
+		{
+			name:           "Thursday at the close",
+			at:             ist(time.November, 12, 15, 30),
+			wantTradingDay: true,
+			wantNextOpen:   ist(time.November, 16, 9, 15), wantPreviousClose: ist(time.November, 12, 15, 30),
+		},
+		{
+			name:         "holiday Friday",
+			at:           ist(time.November, 13, 11, 0),
+			wantNextOpen: ist(time.November, 16, 9, 15), wantPreviousClose: ist(time.November, 12, 15, 30),
+		},
+		{
+			name:         "Saturday after the holiday",
+			at:           ist(time.November, 14, 11, 0),
+			wantNextOpen: ist(time.November, 16, 9, 15), wantPreviousClose: ist(time.November, 12, 15, 30),
+		},
+		{
+			name:         "Monday before the open",
+			at:           ist(time.November, 16, 9, 14),
+			wantNextOpen: ist(time.November, 16, 9, 15), wantPreviousClose: ist(time.November, 12, 15, 30),
+			wantTradingDay: true,
+		},
+		{
+			name:         "Sunday morning before Muhurat",
+			at:           ist(time.November, 8, 10, 0),
+			wantNextOpen: ist(time.November, 8, 18, 0), wantPreviousClose: ist(time.November, 6, 15, 30),
+			wantTradingDay: true,
+		},
+		{
+			name:     "during Muhurat",
+			at:       ist(time.November, 8, 18, 30),
+			wantOpen: true, wantTradingDay: true,
+			wantNextOpen: ist(time.November, 9, 9, 15), wantPreviousClose: ist(time.November, 6, 15, 30),
+		},
+		{
+			name:         "after Muhurat",
+			at:           ist(time.November, 8, 20, 0),
+			wantNextOpen: ist(time.November, 9, 9, 15), wantPreviousClose: ist(time.November, 8, 19, 0),
+			wantTradingDay: true,
+		},
+		{
+			name:         "a UTC time on the IST date",
+			at:           time.Date(2026, time.November, 15, 19, 0, 0, 0, time.UTC), // Monday 00:30 IST
+			wantNextOpen: ist(time.November, 16, 9, 15), wantPreviousClose: ist(time.November, 12, 15, 30),
+			wantTradingDay: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cal.IsOpen(tt.at); got != tt.wantOpen {
+				t.Errorf("IsOpen = %v, want %v", got, tt.wantOpen)
+			}
+			if got := cal.IsTradingDay(tt.at); got != tt.wantTradingDay {
+				t.Errorf("IsTradingDay = %v, want %v", got, tt.wantTradingDay)
+			}
+			if got := cal.NextOpen(tt.at); !got.Equal(tt.wantNextOpen) {
+				t.Errorf("NextOpen = %v, want %v", In(got), tt.wantNextOpen)
+			}
+			if got := cal.PreviousClose(tt.at); !got.Equal(tt.wantPreviousClose) {
+				t.Errorf("PreviousClose = %v, want %v", In(got), tt.wantPreviousClose)
+			}
+		})
+	}
+
+	if name, ok := cal.Holiday(ist(time.November, 13, 0, 0)); !ok || name != "Diwali Balipratipada" {
+		t.Errorf("Holiday = %q, %v; want Diwali Balipratipada", name, ok)
+	}
+}
+
+func TestParseCalendarErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"no version":        `session: {open: "09:15", close: "15:30"}`,
+		"close before open": "version: x\nsession: {open: \"15:30\", close: \"09:15\"}",
+		"bad holiday date":  "version: x\nsession: {open: \"09:15\", close: \"15:30\"}\nholidays: [{date: 13-11-2026, name: x}]",
+	} {
+		if _, err := ParseCalendar([]byte(data)); err == nil {
+			t.Errorf("%s: ParseCalendar succeeded, want an error", name)
+		}
+	}
+}
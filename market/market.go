@@ -0,0 +1,90 @@
+package market
+
+import (
+	"embed"
+	"os"
+	"sync"
+	"time"
+	_ "time/tzdata" // Asia/Kolkata must resolve on hosts without a zoneinfo database
+)
+
+// IST is the exchange's timezone; every time shown to users is in it
+var IST = mustLoadLocation("Asia/Kolkata")
+
+// calendarFiles holds the built-in trading calendar
+//
+//go:embed calendars/nse.yaml
+var calendarFiles embed.FS
+
+var (
+	calendarMu sync.RWMutex
+	calendar   = mustParseCalendar()
+)
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+func mustParseCalendar() *Calendar {
+	data, err := calendarFiles.ReadFile("calendars/nse.yaml")
+	if err != nil {
+		panic(err)
+	}
+	cal, err := ParseCalendar(data)
+	if err != nil {
+		panic(err)
+	}
+	return cal
+}
+
+// LoadCalendar replaces the built-in calendar with the one in file
+func LoadCalendar(file string) (*Calendar, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cal, err := ParseCalendar(data)
+	if err != nil {
+		return nil, err
+	}
+	calendarMu.Lock()
+	calendar = cal
+	calendarMu.Unlock()
+	return cal, nil
+}
+
+// Default returns the calendar in use
+func Default() *Calendar {
+	calendarMu.RLock()
+	defer calendarMu.RUnlock()
+	return calendar
+}
+
+// In returns t in IST
+func In(t time.Time) time.Time {
+	return t.In(IST)
+}
+
+// IsOpen reports whether the market is trading at t
+func IsOpen(t time.Time) bool {
+	return Default().IsOpen(t)
+}
+
+// IsTradingDay reports whether the market holds any session on t's date
+func IsTradingDay(t time.Time) bool {
+	return Default().IsTradingDay(t)
+}
+
+// NextOpen is when the market next opens after t
+func NextOpen(t time.Time) time.Time {
+	return Default().NextOpen(t)
+}
+
+// PreviousClose is the end of the last session to close at or before t
+func PreviousClose(t time.Time) time.Time {
+	return Default().PreviousClose(t)
+}
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	twilioClient "github.com/twilio/twilio-go/client"
+)
+
+const namespace = "stocks_info"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by route and status code.",
+	}, []string{"method", "path", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time spent handling HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "path"})
+
+	InboundMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "inbound_messages_total",
+		Help:      "WhatsApp messages received, by command type.",
+	}, []string{"command"})
+
+	StockSearchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stock_search_duration_seconds",
+		Help:      "Latency of SearchStocks database lookups.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	StockSearchResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stock_search_results_total",
+		Help:      "SearchStocks outcomes: hit when at least one stock matched, index when the query named an index, miss otherwise.",
+	}, []string{"result"})
+
+	QuoteProviderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "quote_provider_request_duration_seconds",
+		Help:      "Latency of quote provider requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+
+	QuoteProviderErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quote_provider_errors_total",
+		Help:      "Failed quote provider requests.",
+	}, []string{"provider"})
+
+	QuotesServed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quotes_served_total",
+		Help:      "Quotes answered, by the provider that served them.",
+	}, []string{"provider"})
+
+	QuoteFailovers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quote_failovers_total",
+		Help:      "Times a provider failed and the chain moved on to the next one.",
+	}, []string{"provider"})
+
+	UpstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_retries_total",
+		Help:      "Retried upstream HTTP requests.",
+	}, []string{"upstream"})
+
+	CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit breaker state per upstream: 0 closed, 1 half-open, 2 open.",
+	}, []string{"upstream"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected or delayed past their deadline by a rate limiter, by scope (user or quote).",
+	}, []string{"scope"})
+
+	TwilioSends = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "twilio_messages_sent_total",
+		Help:      "Messages sent through Twilio, by outcome and Twilio error code.",
+	}, []string{"status", "error_code"})
+
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache name and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	AlertLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alert_lookups_total",
+		Help:      "Stock lookups made by the alert command, by result (found, not_found, ambiguous or error).",
+	}, []string{"result"})
+)
+
+// Handler serves the Prometheus exposition format
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// Middleware records request counts and latency per route
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		HTTPRequests.WithLabelValues(c.Request.Method, path, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPRequestDuration.WithLabelValues(c.Request.Method, path).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveTwilioSend records the outcome of a Twilio API call
+func ObserveTwilioSend(err error) {
+	if err == nil {
+		TwilioSends.WithLabelValues("success", "").Inc()
+		return
+	}
+
+	code := "unknown"
+	var restErr *twilioClient.TwilioRestError
+	if errors.As(err, &restErr) {
+		code = strconv.Itoa(restErr.Code)
+	}
+	TwilioSends.WithLabelValues("failure", code).Inc()
+}
+
+// ObserveCache records a cache lookup
+func ObserveCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheRequests.WithLabelValues(cache, result).Inc()
+}
@@ -0,0 +1,2 @@
+-- Rate limits are configured per tier; everyone starts on the free tier
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier TEXT NOT NULL DEFAULT 'free';
@@ -0,0 +1,15 @@
+-- One-off messages to every subscribed user, sent by the broadcast scheduler
+CREATE TABLE IF NOT EXISTS broadcasts (
+    id                  BIGSERIAL PRIMARY KEY,
+    body                TEXT NOT NULL,
+    template_sid        TEXT NOT NULL DEFAULT '',
+    template_variables  JSONB NOT NULL DEFAULT '{}',
+    status              TEXT NOT NULL DEFAULT 'scheduled',
+    send_at             TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_count          INTEGER NOT NULL DEFAULT 0,
+    failed_count        INTEGER NOT NULL DEFAULT 0,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at        TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS broadcasts_status_send_at_idx ON broadcasts (status, send_at);
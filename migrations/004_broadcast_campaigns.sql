@@ -0,0 +1,23 @@
+-- Broadcasts target a segment of users at a fixed rate and track every recipient.
+-- heartbeat_at lets another instance resume a campaign whose sender died.
+ALTER TABLE broadcasts
+    ADD COLUMN IF NOT EXISTS segment_type     TEXT NOT NULL DEFAULT 'all',
+    ADD COLUMN IF NOT EXISTS segment_symbol   TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS segment_days     INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS rate_per_minute  INTEGER NOT NULL DEFAULT 60,
+    ADD COLUMN IF NOT EXISTS total_recipients INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS heartbeat_at     TIMESTAMPTZ;
+
+-- Interrupted broadcasts are now resumed instead of being left behind
+UPDATE broadcasts SET status = 'scheduled' WHERE status = 'interrupted';
+
+CREATE TABLE IF NOT EXISTS broadcast_recipients (
+    broadcast_id BIGINT NOT NULL REFERENCES broadcasts (id) ON DELETE CASCADE,
+    user_id      UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status       TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    error        TEXT NOT NULL DEFAULT '',
+    attempted_at TIMESTAMPTZ,
+    PRIMARY KEY (broadcast_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS broadcast_recipients_status_idx ON broadcast_recipients (broadcast_id, status);
@@ -0,0 +1,12 @@
+-- A stock row is now one listing: the same company on NSE and BSE has a row
+-- per exchange, linked by ISIN. BSE listings can also be found by scrip code.
+ALTER TABLE stocks
+    ADD COLUMN IF NOT EXISTS exchange   TEXT NOT NULL DEFAULT 'NSE',
+    ADD COLUMN IF NOT EXISTS isin       TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS scrip_code TEXT NOT NULL DEFAULT '';
+
+-- Symbols are only unique per exchange
+ALTER TABLE stocks DROP CONSTRAINT IF EXISTS stocks_symbol_key;
+CREATE UNIQUE INDEX IF NOT EXISTS stocks_symbol_exchange_idx ON stocks (UPPER(symbol), exchange);
+CREATE INDEX IF NOT EXISTS stocks_isin_idx ON stocks (isin) WHERE isin <> '';
+CREATE INDEX IF NOT EXISTS stocks_scrip_code_idx ON stocks (scrip_code) WHERE scrip_code <> '';
@@ -0,0 +1,2 @@
+-- The language a user gets replies in; empty until they pick one or we detect it
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+-- Buys and sells users record over WhatsApp; holdings and P&L are derived
+-- from them by matching sells against buys first in, first out
+CREATE TABLE IF NOT EXISTS transactions (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    symbol     TEXT NOT NULL,
+    exchange   TEXT NOT NULL DEFAULT 'NSE',
+    isin       TEXT NOT NULL DEFAULT '',
+    side       TEXT NOT NULL CHECK (side IN ('buy', 'sell')),
+    quantity   NUMERIC NOT NULL CHECK (quantity > 0),
+    price      NUMERIC NOT NULL CHECK (price >= 0),
+    traded_on  DATE NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS transactions_user_id_traded_on_idx ON transactions (user_id, traded_on, id);
@@ -0,0 +1,19 @@
+-- Trades imported from a broker export remember where they came from, so
+-- importing the same file twice doesn't record them twice
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS source      TEXT NOT NULL DEFAULT 'whatsapp',
+    ADD COLUMN IF NOT EXISTS external_id TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS transactions_external_id_idx
+    ON transactions (user_id, source, external_id) WHERE external_id <> '';
+
+-- A parsed broker export waiting for the user to reply "confirm"; a user has
+-- at most one, and a new upload replaces it
+CREATE TABLE IF NOT EXISTS pending_imports (
+    user_id      UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    broker       TEXT NOT NULL,
+    kind         TEXT NOT NULL CHECK (kind IN ('holdings', 'tradebook')),
+    transactions JSONB NOT NULL,
+    skipped      TEXT[] NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
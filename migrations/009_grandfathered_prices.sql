@@ -0,0 +1,4 @@
+-- Fair market value of a listing on 31 Jan 2018, the highest price quoted that
+-- day. Long-term gains on shares bought before 1 Feb 2018 are grandfathered:
+-- their cost is raised to this value, capped at the sale price.
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS fmv_2018 NUMERIC CHECK (fmv_2018 > 0);
@@ -16,6 +16,13 @@ type TwillioWhatsappMessageRequest struct {
 	From                string `json:"From" form:"From"`
 	To                  string `json:"To" form:"To"`
 	Body                string `json:"Body" form:"Body"`
+	ButtonPayload       string `json:"ButtonPayload" form:"ButtonPayload"`
+	ButtonText          string `json:"ButtonText" form:"ButtonText"`
+	ListId              string `json:"ListId" form:"ListId"`
+	ListTitle           string `json:"ListTitle" form:"ListTitle"`
+	NumMedia            int    `json:"NumMedia" form:"NumMedia"`
+	MediaUrl0           string `json:"MediaUrl0" form:"MediaUrl0"`
+	MediaContentType0   string `json:"MediaContentType0" form:"MediaContentType0"`
 }
 type User struct {
 	ID                      string
@@ -26,44 +33,89 @@ type User struct {
 	LastTwoMessagesFromUser pq.StringArray
 	IsSubscribed            bool
 	SubscribedStocks        pq.StringArray
+	Tier                    string
+	Locale                  string // i18n locale of replies, "" until picked or detected
 }
 
-// type Stock struct {
-// 	Symbol      string `json:"symbol"`
-// 	CompanyName string `json:"company_name"`
-// }
+// Message is one entry of a user's conversation transcript
+type Message struct {
+	ID        int64     `json:"id"`
+	Direction string    `json:"direction"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
 
-type Stock struct {
-	Symbol      string
-	CompanyName string
+// Broadcast is a message sent to a segment of subscribed users once SendAt has passed
+type Broadcast struct {
+	ID                int64             `json:"id"`
+	Body              string            `json:"body"`
+	TemplateSid       string            `json:"template_sid,omitempty"`
+	TemplateVariables map[string]string `json:"template_variables,omitempty"`
+	Segment           BroadcastSegment  `json:"segment"`
+	RatePerMinute     int               `json:"rate_per_minute"`
+	Status            string            `json:"status"`
+	SendAt            time.Time         `json:"send_at"`
+	TotalRecipients   int               `json:"total_recipients"`
+	SentCount         int               `json:"sent_count"`
+	FailedCount       int               `json:"failed_count"`
+	CreatedAt         time.Time         `json:"created_at"`
+	CompletedAt       *time.Time        `json:"completed_at,omitempty"`
 }
 
-type GrowthEntry struct {
-	FromPrice float64
-	ToPrice   float64
-	Growth    float64
+// BroadcastSegment picks the users a broadcast goes to: "all" subscribed users,
+// "watchers" of Symbol, or users "active" in the last Days days
+type BroadcastSegment struct {
+	Type   string `json:"type"`
+	Symbol string `json:"symbol,omitempty"`
+	Days   int    `json:"days,omitempty"`
+}
+
+// BroadcastRecipient is the delivery result of a broadcast for one user
+type BroadcastRecipient struct {
+	UserID      string     `json:"user_id"`
+	PhoneNumber string     `json:"phone_number"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	AttemptedAt *time.Time `json:"attempted_at,omitempty"`
 }
 
-type StockGrowthStats struct {
-	Symbol    string
-	Timestamp time.Time
-	Entries   map[string]GrowthEntry
+// TemplateMessage is a pre-approved WhatsApp template sent through the Content API
+type TemplateMessage struct {
+	ContentSid string
+	Variables  map[string]string
+}
+
+// Stock is one listing of a company on an exchange
+type Stock struct {
+	Symbol      string  `json:"symbol"`
+	CompanyName string  `json:"company_name"`
+	Exchange    string  `json:"exchange"`
+	ISIN        string  `json:"isin,omitempty"`
+	ScripCode   string  `json:"scrip_code,omitempty"` // BSE numeric code
+	FMV2018     float64 `json:"fmv_2018,omitempty"`   // price on 31 Jan 2018, for grandfathering; 0 when unknown
 }
 
 type StockAPIResponse struct {
 	CurrentPrice float64 `json:"current_price"`
 	OpenPrice    float64 `json:"open_price"`
+	Price1w      float64 `json:"price_1w"`
 	Price1m      float64 `json:"price_1m"`
+	Price3m      float64 `json:"price_3m"`
+	Price6m      float64 `json:"price_6m"`
+	PriceYtd     float64 `json:"price_ytd"` // last close of the previous year
 	Price1y      float64 `json:"price_1y"`
 	Price3y      float64 `json:"price_3y"`
 	Price5y      float64 `json:"price_5y"`
 	Symbol       string  `json:"symbol"`
+	QuoteTime    int64   `json:"quote_time"` // unix seconds of the last trade; 0 when the provider doesn't say
 }
 
 type HistoricalEntry struct {
 	FromPrice float64
 	ToPrice   float64
 	Growth    float64 // in percentage
+	Years     float64 // length of the horizon
+	CAGR      float64 // annualised growth in percentage, set for horizons of a year or more
 }
 
 type StockPerformance struct {
@@ -71,8 +123,126 @@ type StockPerformance struct {
 	Symbol      string
 	Current     float64
 	Open        float64
-	Timestamp   time.Time
+	Timestamp   time.Time // when the provider priced the quote
 	Entries     map[string]HistoricalEntry
+	Horizons    []string // labels of Entries in display order; every entry in the standard order when empty
+	Source      string   // quote provider that served the data
+	Exchange    string
+	IsIndex     bool           // an index level rather than a price in rupees
+	Listings    []ListingPrice // prices on every exchange, when listed on more than one
+	MarketOpen  bool
+	LastClose   time.Time // end of the last session, shown while the market is closed
+}
+
+// ListingPrice is the current price of a stock on one exchange
+type ListingPrice struct {
+	Exchange string
+	Price    float64
+}
+
+// Transaction is a buy or sell of a listing recorded by a user
+type Transaction struct {
+	ID         int64     `json:"id"`
+	UserID     string    `json:"user_id"`
+	Symbol     string    `json:"symbol"`
+	Exchange   string    `json:"exchange"`
+	ISIN       string    `json:"isin,omitempty"`
+	Side       string    `json:"side"` // "buy" or "sell"
+	Quantity   float64   `json:"quantity"`
+	Price      float64   `json:"price"`
+	TradedOn   time.Time `json:"traded_on"`
+	Source     string    `json:"source"`                // "whatsapp" or the broker it was imported from
+	ExternalID string    `json:"external_id,omitempty"` // the broker's trade id, for imports
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PendingImport is a parsed broker export the user hasn't confirmed yet
+type PendingImport struct {
+	Broker       string        `json:"broker"`
+	Kind         string        `json:"kind"` // "holdings" or "tradebook"
+	Transactions []Transaction `json:"transactions"`
+	Skipped      []string      `json:"skipped"` // rows left out, and why
+	AlreadyHeld  int           `json:"-"`       // holdings left out as already recorded, for the preview
+	CreatedAt    time.Time     `json:"created_at"`
+}
+
+// Lot is shares bought in one transaction and not yet sold
+type Lot struct {
+	Quantity    float64
+	Price       float64
+	BoughtOn    time.Time
+	DateUnknown bool // imported from a holdings file, so BoughtOn is the day of the import
+}
+
+// Disposal is part of a sale matched against the lot it sold from
+type Disposal struct {
+	Symbol      string
+	Exchange    string
+	ISIN        string
+	Quantity    float64
+	BuyPrice    float64
+	BoughtOn    time.Time
+	SellPrice   float64
+	SoldOn      time.Time
+	DateUnknown bool // the lot came from a holdings file, so BoughtOn is the day of the import
+}
+
+// CapitalGain is the taxable gain on one disposal
+type CapitalGain struct {
+	Disposal
+	LongTerm      bool    // held for more than 12 months
+	CostPrice     float64 // cost per share, after grandfathering
+	Grandfathered bool    // cost raised to the 31 Jan 2018 price
+	MissingFMV    bool    // eligible for grandfathering but the 31 Jan 2018 price is unknown
+	Cost          float64
+	Proceeds      float64
+	Gain          float64 // negative for a loss
+	Rate          float64 // tax rate in percentage
+}
+
+// CapitalGainsReport sums up the realised gains of a financial year. Losses
+// are set off the way the Income Tax Act allows: short-term losses against
+// any gains, long-term losses against long-term gains only.
+type CapitalGainsReport struct {
+	FinancialYear    int // the year it starts in, 2025 for FY2025-26
+	Gains            []CapitalGain
+	ShortTerm        float64 // net short-term gain, before set-off
+	LongTerm         float64 // net long-term gain, before set-off
+	Exemption        float64 // long-term gains exempt under section 112A
+	TaxableShortTerm float64
+	TaxableLongTerm  float64
+	EstimatedTax     float64 // before surcharge and cess
+	CarriedForward   float64 // losses left to set off in later years
+	Grandfathered    bool
+	MissingFMV       bool
+	DateUnknown      bool // some lots came from holdings files, without their real purchase dates
+	RatesChanged     bool // sales fall on both sides of a change in rates
+}
+
+// Holding is a user's position in one listing, built from their transactions
+type Holding struct {
+	Symbol      string
+	Exchange    string
+	ISIN        string
+	Lots        []Lot   // open lots, oldest first
+	Quantity    float64 // shares still held
+	Invested    float64 // cost of the shares still held
+	AverageCost float64
+	Realised    float64 // profit on shares already sold
+	Current     float64 // latest price; 0 when it couldn't be quoted
+	Value       float64
+	Unrealised  float64
+}
+
+// Portfolio is every holding of a user with their totals. Value and
+// Unrealised only cover holdings that could be priced.
+type Portfolio struct {
+	Holdings   []*Holding
+	Invested   float64
+	Value      float64
+	Unrealised float64
+	Realised   float64
+	Unpriced   bool // some open holding couldn't be priced
 }
 
 // NSEResponse - exported struct (capitalized name)
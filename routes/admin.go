@@ -0,0 +1,507 @@
+package routes
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stocks-info-channel/config"
+	"stocks-info-channel/helper"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/model"
+	"stocks-info-channel/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// userResponse is the admin view of a user
+type userResponse struct {
+	ID               string     `json:"id"`
+	PhoneNumber      string     `json:"phone_number"`
+	Name             string     `json:"name,omitempty"`
+	IsSubscribed     bool       `json:"is_subscribed"`
+	SubscribedStocks []string   `json:"subscribed_stocks"`
+	LastMessageTime  *time.Time `json:"last_message_time,omitempty"`
+	Tier             string     `json:"tier"`
+	Locale           string     `json:"locale,omitempty"`
+}
+
+func newUserResponse(user *model.User) userResponse {
+	resp := userResponse{
+		ID:               user.ID,
+		PhoneNumber:      user.PhoneNumber,
+		Name:             user.Name.String,
+		IsSubscribed:     user.IsSubscribed,
+		SubscribedStocks: user.SubscribedStocks,
+		Tier:             user.Tier,
+		Locale:           user.Locale,
+	}
+	if resp.SubscribedStocks == nil {
+		resp.SubscribedStocks = []string{}
+	}
+	if user.LastMessageTime.Valid {
+		resp.LastMessageTime = &user.LastMessageTime.Time
+	}
+	return resp
+}
+
+type stockRequest struct {
+	Symbol      string  `json:"symbol"`
+	CompanyName string  `json:"company_name" binding:"required"`
+	Exchange    string  `json:"exchange"`
+	ISIN        string  `json:"isin"`
+	ScripCode   string  `json:"scrip_code"`
+	FMV2018     float64 `json:"fmv_2018"`
+}
+
+func (r stockRequest) stock() model.Stock {
+	return model.Stock{
+		Symbol:      r.Symbol,
+		CompanyName: r.CompanyName,
+		Exchange:    r.Exchange,
+		ISIN:        r.ISIN,
+		ScripCode:   r.ScripCode,
+		FMV2018:     r.FMV2018,
+	}
+}
+
+type sendMessageRequest struct {
+	Body     string                 `json:"body" binding:"required"`
+	Template *model.TemplateMessage `json:"template"`
+}
+
+type broadcastRequest struct {
+	Body              string                  `json:"body" binding:"required"`
+	TemplateSid       string                  `json:"template_sid"`
+	TemplateVariables map[string]string       `json:"template_variables"`
+	Segment           *model.BroadcastSegment `json:"segment"`
+	RatePerMinute     int                     `json:"rate_per_minute"`
+	SendAt            *time.Time              `json:"send_at"`
+	DryRun            bool                    `json:"dry_run"`
+}
+
+// RegisterAdminRoutes mounts the support staff API under /admin. Every request
+// must carry "Authorization: Bearer <ADMIN_API_TOKEN>"; without a configured
+// token the API is not mounted at all.
+func RegisterAdminRoutes(router *gin.Engine, db *sql.DB, cfg *config.Config, quotes *services.QuoteChain) {
+	if cfg.AdminAPIToken == "" {
+		slog.Warn("ADMIN_API_TOKEN is not set, admin API is disabled")
+		return
+	}
+
+	admin := router.Group("/admin", adminAuth(cfg.AdminAPIToken))
+
+	admin.GET("/users", listUsersHandler(db))
+	admin.GET("/users/:phone", getUserHandler(db))
+	admin.GET("/users/:phone/transcript", transcriptHandler(db))
+	admin.POST("/users/:phone/messages", sendMessageHandler(db, cfg))
+	// A broker CSV, as a multipart "file" or the raw body, for the user to confirm
+	admin.POST("/users/:phone/imports", importHandler(db, cfg))
+
+	admin.GET("/stocks", listStocksHandler(db))
+	admin.POST("/stocks", createStockHandler(db))
+	// Listings other than NSE are picked with ?exchange=BSE
+	admin.PUT("/stocks/:symbol", updateStockHandler(db))
+	admin.DELETE("/stocks/:symbol", deleteStockHandler(db))
+
+	admin.GET("/broadcasts", listBroadcastsHandler(db))
+	admin.GET("/broadcasts/:id", getBroadcastHandler(db))
+	admin.GET("/broadcasts/:id/recipients", broadcastRecipientsHandler(db))
+	admin.POST("/broadcasts", createBroadcastHandler(db, cfg))
+	admin.POST("/broadcasts/:id/pause", changeBroadcastHandler(db, services.PauseBroadcast))
+	admin.POST("/broadcasts/:id/resume", changeBroadcastHandler(db, services.ResumeBroadcast))
+
+	admin.GET("/quote-providers", quoteProvidersHandler(quotes))
+}
+
+// adminAuth accepts only "Authorization: Bearer <token>"; an empty token
+// rejects every request rather than matching an empty header
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func listUsersHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := services.UserFilter{Query: c.Query("q")}
+		filter.Limit, filter.Offset = pagination(c)
+		if value := c.Query("subscribed"); value != "" {
+			subscribed, err := strconv.ParseBool(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "subscribed must be true or false"})
+				return
+			}
+			filter.Subscribed = &subscribed
+		}
+
+		users, err := services.ListUsers(c.Request.Context(), db, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := make([]userResponse, 0, len(users))
+		for _, user := range users {
+			resp = append(resp, newUserResponse(user))
+		}
+		c.JSON(http.StatusOK, gin.H{"users": resp})
+	}
+}
+
+func getUserHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, newUserResponse(user))
+	}
+}
+
+func transcriptHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+		limit, _ := pagination(c)
+
+		messages, err := services.GetTranscript(c.Request.Context(), db, user, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if messages == nil {
+			messages = []model.Message{}
+		}
+		c.JSON(http.StatusOK, gin.H{"user": newUserResponse(user), "messages": messages})
+	}
+}
+
+func sendMessageHandler(db *sql.DB, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req sendMessageRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+
+		ctx := c.Request.Context()
+		var template model.TemplateMessage
+		if req.Template != nil {
+			template = *req.Template
+		}
+		if _, err := services.SendProactiveWhatsApp(ctx, cfg, user, req.Body, template); err != nil {
+			status := http.StatusBadGateway
+			if errors.Is(err, services.ErrSessionWindowClosed) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		if err := services.RecordMessage(ctx, db, user, services.DirectionOutbound, req.Body); err != nil {
+			logging.FromContext(ctx).Warn("failed to record outbound message", "error", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "sent"})
+	}
+}
+
+// importHandler prepares a broker export on a user's behalf and sends them the
+// preview; like an attachment they send themselves, it is applied only once
+// they reply confirm
+func importHandler(db *sql.DB, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+
+		var upload io.Reader = http.MaxBytesReader(c.Writer, c.Request.Body, helper.AppConstant().MaxImportBytes)
+		if file, err := c.FormFile("file"); err == nil {
+			f, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			defer f.Close()
+			upload = io.LimitReader(f, helper.AppConstant().MaxImportBytes)
+		}
+
+		ctx := c.Request.Context()
+		pending, err := services.PrepareImport(ctx, db, user, upload)
+		switch {
+		case errors.Is(err, services.ErrUnknownFormat):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// The import waits for the user even when they can't be messaged right now
+		preview := helper.ImportPreviewMessage(user.Locale, pending)
+		_, err = services.SendProactiveWhatsApp(ctx, cfg, user, preview, model.TemplateMessage{})
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed to send import preview", "error", err)
+		} else if err := services.RecordMessage(ctx, db, user, services.DirectionOutbound, preview); err != nil {
+			logging.FromContext(ctx).Warn("failed to record outbound message", "error", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"import": pending, "notified": err == nil})
+	}
+}
+
+func listStocksHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, offset := pagination(c)
+		stocks, err := services.ListStocks(c.Request.Context(), db, c.Query("q"), limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if stocks == nil {
+			stocks = []model.Stock{}
+		}
+		c.JSON(http.StatusOK, gin.H{"stocks": stocks})
+	}
+}
+
+func createStockHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req stockRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Symbol == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "symbol and company_name are required"})
+			return
+		}
+		if err := services.CreateStock(c.Request.Context(), db, req.stock()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"status": "created"})
+	}
+}
+
+func updateStockHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req stockRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "company_name is required"})
+			return
+		}
+		err := services.UpdateStock(c.Request.Context(), db, c.Param("symbol"), c.Query("exchange"), req.stock())
+		respondStockEdit(c, err, "updated")
+	}
+}
+
+func deleteStockHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := services.DeleteStock(c.Request.Context(), db, c.Param("symbol"), c.Query("exchange"))
+		respondStockEdit(c, err, "deleted")
+	}
+}
+
+func respondStockEdit(c *gin.Context, err error, status string) {
+	switch {
+	case errors.Is(err, services.ErrStockNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"status": status})
+	}
+}
+
+func listBroadcastsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, offset := pagination(c)
+		broadcasts, err := services.ListBroadcasts(c.Request.Context(), db, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if broadcasts == nil {
+			broadcasts = []*model.Broadcast{}
+		}
+		c.JSON(http.StatusOK, gin.H{"broadcasts": broadcasts})
+	}
+}
+
+func getBroadcastHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, ok := loadBroadcast(c, db)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, b)
+	}
+}
+
+// broadcastRecipientsHandler lists per-user delivery results, e.g. ?status=failed
+func broadcastRecipientsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, ok := loadBroadcast(c, db)
+		if !ok {
+			return
+		}
+		limit, offset := pagination(c)
+		recipients, err := services.ListBroadcastRecipients(c.Request.Context(), db, b.ID, c.Query("status"), limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if recipients == nil {
+			recipients = []model.BroadcastRecipient{}
+		}
+		c.JSON(http.StatusOK, gin.H{"broadcast": b, "recipients": recipients})
+	}
+}
+
+// createBroadcastHandler schedules a broadcast to a segment of subscribed
+// users (all of them by default). With dry_run it only reports how many users
+// would receive it.
+func createBroadcastHandler(db *sql.DB, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req broadcastRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		segment := model.BroadcastSegment{Type: services.SegmentAll}
+		if req.Segment != nil {
+			segment = *req.Segment
+		}
+		if err := services.ValidateSegment(segment); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.RatePerMinute < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rate_per_minute must be positive"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		recipients, err := services.CountSegmentUsers(ctx, db, segment)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if req.DryRun {
+			c.JSON(http.StatusOK, gin.H{"dry_run": true, "recipients": recipients})
+			return
+		}
+
+		b := &model.Broadcast{
+			Body:              req.Body,
+			TemplateSid:       req.TemplateSid,
+			TemplateVariables: req.TemplateVariables,
+			Segment:           segment,
+			RatePerMinute:     cmp.Or(req.RatePerMinute, cfg.BroadcastRatePerMinute),
+		}
+		if req.SendAt != nil {
+			b.SendAt = *req.SendAt
+		}
+		b, err = services.ScheduleBroadcast(ctx, db, b)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"broadcast": b, "recipients": recipients})
+	}
+}
+
+// changeBroadcastHandler pauses or resumes a broadcast through change
+func changeBroadcastHandler(db *sql.DB, change func(context.Context, *sql.DB, int64) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b, ok := loadBroadcast(c, db)
+		if !ok {
+			return
+		}
+		ctx := c.Request.Context()
+		if err := change(ctx, db, b.ID); errors.Is(err, services.ErrBroadcastState) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": b.Status})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		b, err := services.GetBroadcast(ctx, db, b.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, b)
+	}
+}
+
+// loadBroadcast fetches the broadcast named by the :id parameter, writing the error response itself
+func loadBroadcast(c *gin.Context, db *sql.DB) (*model.Broadcast, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid broadcast id"})
+		return nil, false
+	}
+	b, err := services.GetBroadcast(c.Request.Context(), db, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "broadcast not found"})
+		return nil, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return b, true
+}
+
+// loadUser fetches the user named by the :phone parameter, writing the error response itself
+func loadUser(c *gin.Context, db *sql.DB) (*model.User, bool) {
+	user, err := services.GetUserByPhone(c.Request.Context(), db, c.Param("phone"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return user, true
+}
+
+// pagination reads ?limit= and ?offset=, clamping limit to maxPageSize
+func pagination(c *gin.Context) (limit int, offset int) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	offset, err = strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return min(limit, maxPageSize), offset
+}
+
+func quoteProvidersHandler(quotes *services.QuoteChain) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"quote_providers": quotes.Health()})
+	}
+}
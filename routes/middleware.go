@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"stocks-info-channel/config"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTimeout gives every request a deadline that reaches the DB and upstream calls
+func RequestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// TwilioSignature rejects webhooks that don't carry a valid X-Twilio-Signature,
+// so nobody but Twilio can post messages as a user or hand us media URLs
+func TwilioSignature(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cfg.TwilioVerifySignature {
+			c.Next()
+			return
+		}
+		if err := c.Request.ParseForm(); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+		if !services.ValidTwilioSignature(cfg, webhookURL(c, cfg), c.Request.PostForm, c.GetHeader("X-Twilio-Signature")) {
+			logging.FromContext(c.Request.Context()).Warn("rejected webhook with invalid twilio signature", "path", c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Invalid signature"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// webhookURL is the URL Twilio posted to, which the signature covers. Behind a
+// proxy the request doesn't know it, so PUBLIC_BASE_URL wins when set.
+func webhookURL(c *gin.Context, cfg *config.Config) string {
+	if cfg.PublicBaseURL != "" {
+		return strings.TrimSuffix(cfg.PublicBaseURL, "/") + c.Request.URL.RequestURI()
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + c.Request.URL.RequestURI()
+}
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"stocks-info-channel/config"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TaxReportHandler serves the capital gains CSV behind a link made by
+// services.TaxReportURL. The report is built afresh from the user's
+// transactions, so nothing is stored between the link and the download.
+func TaxReportHandler(db *sql.DB, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userID := c.Param("user")
+		fy, err := strconv.Atoi(c.Param("fy"))
+		expires, expiresErr := strconv.ParseInt(c.Query("expires"), 10, 64)
+		if err != nil || expiresErr != nil ||
+			!services.VerifyTaxReportLink(cfg, userID, fy, expires, c.Query("sig"), time.Now()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This link is invalid or has expired"})
+			return
+		}
+
+		user, err := services.GetUserByID(ctx, db, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		} else if err != nil {
+			logging.FromContext(ctx).Error("failed to load user", "user_id", userID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+			return
+		}
+
+		report, err := services.CapitalGains(ctx, db, user, fy)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to build capital gains report", "user_id", userID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var csv bytes.Buffer
+		if err := services.WriteCapitalGainsCSV(&csv, report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="`+services.CapitalGainsFileName(fy)+`"`)
+		c.Header("Cache-Control", "private, no-store")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", csv.Bytes())
+	}
+}
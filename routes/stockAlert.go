@@ -3,12 +3,30 @@ package routes
 import (
 	"database/sql"
 	"net/http"
+	"time"
+
+	"stocks-info-channel/config"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/market"
 
 	"github.com/gin-gonic/gin"
 )
 
-func StockAlertHandler(db *sql.DB) gin.HandlerFunc {
+func StockAlertHandler(db *sql.DB, cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Prices don't move outside a session, so there is nothing to evaluate
+		now := time.Now()
+		if !market.IsOpen(now) {
+			nextOpen := market.NextOpen(now)
+			logging.FromContext(c.Request.Context()).Info("market closed, skipping alert evaluation", "next_open", nextOpen)
+			c.JSON(http.StatusOK, gin.H{
+				"status":    "skipped",
+				"message":   "Market closed",
+				"next_open": nextOpen,
+			})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"status":  "😁",
 			"message": "🚧 Currently under construction.",
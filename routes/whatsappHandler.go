@@ -1,20 +1,28 @@
 package routes
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
-	"log"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"stocks-info-channel/config"
 	"stocks-info-channel/helper"
+	"stocks-info-channel/i18n"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/metrics"
 	"stocks-info-channel/model"
 	"stocks-info-channel/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-func WhatsAppIncomingHandler(db *sql.DB) gin.HandlerFunc {
+func WhatsAppIncomingHandler(db *sql.DB, cfg *config.Config, quotes *services.QuoteChain, limiter *services.UserLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		ctx := c.Request.Context()
 		var message model.TwillioWhatsappMessageRequest
 		if err := c.Bind(&message); err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
@@ -24,52 +32,157 @@ func WhatsAppIncomingHandler(db *sql.DB) gin.HandlerFunc {
 		phone := strings.TrimPrefix(message.From, helper.AppConstant().WhatsApp)
 		body := strings.ToLower(message.Body)
 
-		log.Println("Message from :- ", message.From)
-		log.Println("Message To :- ", message.To)
-		log.Println("Message Body :- ", message.Body)
-		log.Println("Message AccountSid :- ", message.AccountSid)
-		log.Println("Message MessageSid :- ", message.MessageSid)
-		log.Println("Message SmsSid :- ", message.SmsSid)
-		log.Println("Message SmsMessageSid :- ", message.SmsMessageSid)
+		// A tapped button or list item carries the chosen command in its payload
+		if payload := firstNonEmpty(message.ButtonPayload, message.ListId); payload != "" {
+			if action, symbol, ok := helper.ParseChoicePayload(payload); ok {
+				logging.FromContext(ctx).Debug("message carries a choice payload", "payload", payload)
+				body = strings.ToLower(action + " " + symbol)
+			}
+		}
 
-		user, err := services.GetOrCreateUser(db, phone)
-		if err != nil {
+		// Every log line for this message carries the Twilio SIDs; PII is masked by the handler
+		ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With(
+			"message_sid", message.MessageSid,
+			"account_sid", message.AccountSid,
+		))
+		logger := logging.FromContext(ctx)
+		logger.Info("incoming whatsapp message",
+			"from", phone,
+			"to", strings.TrimPrefix(message.To, helper.AppConstant().WhatsApp),
+			"body", message.Body,
+			"sms_sid", message.SmsSid,
+		)
+
+		// Throttle before any writes, so a flood costs one read per message and
+		// doesn't keep the session window open
+		user, err := services.GetUserByPhone(ctx, db, phone)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logger.Error("failed to load user", "phone", phone, "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
 			return
 		}
+		tier := config.DefaultTier
+		if user != nil {
+			tier = user.Tier
+		}
+		if allowed, notify, wait := limiter.Allow(phone, tier); !allowed {
+			logger.Info("user is over their rate limit", "tier", tier, "notified", notify, "wait_ms", wait.Milliseconds())
+			if notify && user != nil {
+				services.SendAndRecord(ctx, db, cfg, user, helper.SlowDownMessage(user.Locale, wait))
+			}
+			c.JSON(http.StatusOK, gin.H{"status": "Rate limited"})
+			return
+		}
+
+		if user == nil {
+			if user, err = services.GetOrCreateUser(ctx, db, phone); err != nil {
+				logger.Error("failed to load user", "phone", phone, "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+				return
+			}
+		}
+		ctx = logging.WithLogger(ctx, logger.With("user_id", user.ID))
+		logger = logging.FromContext(ctx)
+
+		if err := services.TouchLastMessageTime(ctx, db, user); err != nil {
+			logger.Warn("failed to update last message time", "error", err)
+		}
+		if err := services.RecordMessage(ctx, db, user, services.DirectionInbound, message.Body); err != nil {
+			logger.Warn("failed to record inbound message", "error", err)
+		}
+
+		// A new user's locale comes from the script of their first message
+		if user.Locale == "" {
+			locale, ok := i18n.DetectLocale(message.Body)
+			if !ok {
+				locale = i18n.DefaultLocale
+			}
+			if err := services.SetUserLocale(ctx, db, user, locale); err != nil {
+				logger.Warn("failed to store detected locale", "locale", locale, "error", err)
+				user.Locale = locale
+			}
+		}
+
+		// An attachment is a broker export to import, whatever the caption says
+		if message.NumMedia > 0 && message.MediaUrl0 != "" {
+			logger.Info("handling broker import", "content_type", message.MediaContentType0)
+			metrics.InboundMessages.WithLabelValues("import").Inc()
+			handleImport(ctx, db, cfg, user, message.MediaUrl0, message.MediaContentType0, c)
+			return
+		}
 
+		// Commands can be typed in any supported language, e.g. "शेयर tcs"
+		command, arg := i18n.ParseCommand(body)
 		switch {
-		case strings.HasPrefix(body, "stock "):
-			log.Println("Handling Stock search query...")
-			handleStockQuery(db, phone, user, strings.TrimPrefix(body, "stock "), c)
-		case strings.HasPrefix(body, "alert "):
-			log.Println("Handling Stock alert query...")
-			handleStockAlerts(db, phone, user, strings.TrimPrefix(body, "alert "), c)
-		case body == "top stocks":
+		case command == i18n.CommandStock && arg != "":
+			logger.Info("handling stock search query")
+			metrics.InboundMessages.WithLabelValues("stock").Inc()
+			handleStockQuery(ctx, db, cfg, quotes, phone, user, arg, c)
+		case command == i18n.CommandAlert && arg != "":
+			logger.Info("handling stock alert query")
+			metrics.InboundMessages.WithLabelValues("alert").Inc()
+			handleStockAlerts(ctx, db, cfg, quotes, phone, user, arg, c)
+		case command == i18n.CommandIndex && arg != "":
+			logger.Info("handling index query")
+			metrics.InboundMessages.WithLabelValues("index").Inc()
+			handleIndexQuery(ctx, db, cfg, quotes, user, arg, c)
+		case command == i18n.CommandCompare:
+			logger.Info("handling compare query")
+			metrics.InboundMessages.WithLabelValues("compare").Inc()
+			handleCompare(ctx, db, cfg, quotes, user, arg, c)
+		case command == i18n.CommandBuy || command == i18n.CommandSell:
+			logger.Info("handling trade", "side", command)
+			metrics.InboundMessages.WithLabelValues("trade").Inc()
+			handleTrade(ctx, db, cfg, user, command, arg, c)
+		case command == i18n.CommandPortfolio && arg == "":
+			logger.Info("handling portfolio query")
+			metrics.InboundMessages.WithLabelValues("portfolio").Inc()
+			handlePortfolio(ctx, db, cfg, quotes, user, c)
+		case command == i18n.CommandTax:
+			logger.Info("handling tax report", "year", arg)
+			metrics.InboundMessages.WithLabelValues("tax").Inc()
+			handleTaxReport(ctx, db, cfg, user, arg, c)
+		case command == i18n.CommandConfirm && arg == "":
+			logger.Info("confirming pending import")
+			metrics.InboundMessages.WithLabelValues("import_confirm").Inc()
+			handleConfirmImport(ctx, db, cfg, user, c)
+		case command == i18n.CommandCancel && arg == "":
+			logger.Info("cancelling pending import")
+			metrics.InboundMessages.WithLabelValues("import_cancel").Inc()
+			handleCancelImport(ctx, db, cfg, user, c)
+		case command == i18n.CommandLanguage:
+			logger.Info("handling language change", "language", arg)
+			metrics.InboundMessages.WithLabelValues("language").Inc()
+			handleLanguage(ctx, db, cfg, user, arg, c)
+		case command == i18n.CommandTopStocks && arg == "":
+			metrics.InboundMessages.WithLabelValues("top_stocks").Inc()
 			// TODO: implement top stocks logic
 			c.JSON(http.StatusOK, gin.H{"msg": "Coming soon!"})
 		default:
-			resp := helper.WelcomeMessage()
-			_, _ = services.SendWhatsApp(phone, resp)
+			metrics.InboundMessages.WithLabelValues("welcome").Inc()
+			resp := helper.WelcomeMessage(user.Locale)
+			services.SendAndRecord(ctx, db, cfg, user, resp)
 			c.JSON(http.StatusOK, gin.H{"message": "Default welcome sent"})
 		}
 	}
 }
 
-func handleStockQuery(db *sql.DB, phone string, user *model.User, query string, c *gin.Context) {
-	matches, err := services.SearchStocks(db, query)
-	log.Println("Matches :- ", matches)
+func handleStockQuery(ctx context.Context, db *sql.DB, cfg *config.Config, quotes *services.QuoteChain, phone string, user *model.User, query string, c *gin.Context) {
+	logger := logging.FromContext(ctx)
+	parsed := services.ParseStockQuery(query)
+	matches, err := services.SearchStocks(ctx, db, parsed.Text, parsed.Exchange)
 	if err != nil {
-		log.Println("Error :- ", err.Error())
+		logger.Error("stock search failed", "query", parsed.Text, "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	switch len(matches) {
+	companies := services.GroupListings(matches)
+	switch len(companies) {
 	case 0: // No stock found
-		log.Println("No stock found...")
+		logger.Info("no stock found", "query", parsed.Text)
 
-		userHasCheckFor2Times, error := services.CheckForTwoStockSeachTries(db, user)
+		userHasCheckFor2Times, error := services.CheckForTwoStockSeachTries(ctx, db, user)
 		if error != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status": "Could not save the message in DB",
@@ -77,23 +190,23 @@ func handleStockQuery(db *sql.DB, phone string, user *model.User, query string,
 			})
 		}
 		if userHasCheckFor2Times {
-			msg := helper.StockNotInDatabaseMessage()
-			err := services.ClearLastTwoMessages(db, user)
+			msg := helper.StockNotInDatabaseMessage(user.Locale)
+			err := services.ClearLastTwoMessages(ctx, db, user)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"message": "Could not clear out the last 2 messages sent to user from DB",
 					"error":   err.Error(),
 				})
 			}
-			services.SendWhatsApp(phone, msg)
+			services.SendAndRecord(ctx, db, cfg, user, msg)
 			c.JSON(http.StatusOK, gin.H{
 				"message": "Could not clear out the last 2 messages sent to user from DB",
 				"error":   err.Error(),
 			})
 			return
 		} else {
-			msg := helper.NoStockFoundMessage()
-			err := services.UpdateSentMessagesToUser(db, user, msg)
+			msg := helper.NoStockFoundMessage(user.Locale)
+			err := services.UpdateSentMessagesToUser(ctx, db, user, msg)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"message": "Could not save the message in DB",
@@ -101,64 +214,357 @@ func handleStockQuery(db *sql.DB, phone string, user *model.User, query string,
 				})
 				return
 			}
-			services.SendWhatsApp(phone, msg)
+			services.SendAndRecord(ctx, db, cfg, user, msg)
 			return
 		}
 	case 1: // exact match found for the stock
-		log.Println(" Stock Symbol :- ", matches[0].Symbol)
-		log.Println(" Company Name :- ", matches[0].CompanyName)
-		stockPerformance, err := services.GetStockPerformance(matches[0].Symbol+".NS", matches[0].CompanyName)
-		log.Println("Stock Performance :- ", stockPerformance)
+		logger.Info("stock matched", "symbol", matches[0].Symbol, "company", matches[0].CompanyName, "listings", len(companies[0]))
+		stockPerformance, err := services.GetListingsPerformance(ctx, quotes, companies[0])
 		if err != nil {
-			log.Println("Failed to fetch stock price...")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock price"})
+			// Tell the user rather than failing the webhook, which would only make Twilio retry
+			logger.Error("failed to fetch stock price", "symbol", matches[0].Symbol, "error", err)
+			services.SendAndRecord(ctx, db, cfg, user, helper.PriceServiceUnavailableMessage(user.Locale))
+			c.JSON(http.StatusOK, gin.H{"status": "Price service unavailable"})
 			return
 		}
-		msg := helper.SingleStockPerformanceMessage(stockPerformance)
-		services.SendWhatsApp(phone, msg)
+		stockPerformance = services.SelectHorizons(stockPerformance, horizons(cfg, parsed))
+		msg := helper.SingleStockPerformanceMessage(user.Locale, stockPerformance)
+		services.SendAndRecord(ctx, db, cfg, user, msg)
 	default: // multiple company found with stock name
-		msg := helper.GenerateCompanyMessage(matches)
-		err := services.UpdateSentMessagesToUser(db, user, msg)
+		msg := services.SendCompanyChoices(ctx, cfg, phone, user.Locale, firstListings(companies), "stock")
+		if err := services.RecordMessage(ctx, db, user, services.DirectionOutbound, msg); err != nil {
+			logging.FromContext(ctx).Warn("failed to record outbound message", "error", err)
+		}
+		err := services.UpdateSentMessagesToUser(ctx, db, user, msg)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"message": "Could not save the message in DB",
 				"error":   err.Error(),
 			})
 		}
-		services.SendWhatsApp(phone, msg)
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "Stock response sent"})
 }
 
-func handleStockAlerts(db *sql.DB, phone string, user *model.User, query string, c *gin.Context) {
-	matches, err := services.SearchStocks(db, query)
+func handleStockAlerts(ctx context.Context, db *sql.DB, cfg *config.Config, quotes *services.QuoteChain, phone string, user *model.User, query string, c *gin.Context) {
+	parsed := services.ParseStockQuery(query)
+	matches, err := services.SearchStocks(ctx, db, parsed.Text, parsed.Exchange)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	switch len(matches) {
+	companies := services.GroupListings(matches)
+	switch len(companies) {
 	case 0: // No stock font
-		msg := helper.NoStockFoundMessage()
-		services.SendWhatsApp(phone, msg)
+		metrics.AlertLookups.WithLabelValues("not_found").Inc()
+		msg := helper.NoStockFoundMessage(user.Locale)
+		services.SendAndRecord(ctx, db, cfg, user, msg)
 	case 1: // exact match found for the stock
-		stockPerformance, err := services.GetStockPerformance(matches[0].Symbol+".NS", matches[0].CompanyName)
+		stockPerformance, err := services.GetListingsPerformance(ctx, quotes, companies[0])
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock price"})
+			metrics.AlertLookups.WithLabelValues("error").Inc()
+			logging.FromContext(ctx).Error("failed to fetch stock price", "symbol", matches[0].Symbol, "error", err)
+			services.SendAndRecord(ctx, db, cfg, user, helper.PriceServiceUnavailableMessage(user.Locale))
+			c.JSON(http.StatusOK, gin.H{"status": "Price service unavailable"})
 			return
 		}
-		msg := helper.SingleStockPerformanceMessage(stockPerformance)
-		services.SendWhatsApp(phone, msg)
+		metrics.AlertLookups.WithLabelValues("found").Inc()
+		stockPerformance = services.SelectHorizons(stockPerformance, horizons(cfg, parsed))
+		msg := helper.SingleStockPerformanceMessage(user.Locale, stockPerformance)
+		services.SendAndRecord(ctx, db, cfg, user, msg)
 	default: // multiple company found with stock name
-		msg := helper.GenerateCompanyMessage(matches)
-		err := services.UpdateSentMessagesToUser(db, user, msg)
+		metrics.AlertLookups.WithLabelValues("ambiguous").Inc()
+		msg := services.SendCompanyChoices(ctx, cfg, phone, user.Locale, firstListings(companies), "alert")
+		if err := services.RecordMessage(ctx, db, user, services.DirectionOutbound, msg); err != nil {
+			logging.FromContext(ctx).Warn("failed to record outbound message", "error", err)
+		}
+		err := services.UpdateSentMessagesToUser(ctx, db, user, msg)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"status": "Could not save the message in DB",
 				"error":  err.Error(),
 			})
 		}
-		services.SendWhatsApp(phone, msg)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "Alert messages dispatched"})
 }
+
+func handleIndexQuery(ctx context.Context, db *sql.DB, cfg *config.Config, quotes *services.QuoteChain, user *model.User, query string, c *gin.Context) {
+	logger := logging.FromContext(ctx)
+	parsed := services.ParseStockQuery(query)
+	index, ok := services.FindIndex(parsed.Text, true)
+	if !ok {
+		logger.Info("no index found", "query", parsed.Text)
+		names := make([]string, 0, len(services.Indices()))
+		for _, index := range services.Indices() {
+			names = append(names, index.Name)
+		}
+		services.SendAndRecord(ctx, db, cfg, user, helper.UnknownIndexMessage(user.Locale, names))
+		c.JSON(http.StatusOK, gin.H{"status": "Index not found"})
+		return
+	}
+
+	performance, err := services.GetStockPerformance(ctx, quotes, index.Stock())
+	if err != nil {
+		logger.Error("failed to fetch index level", "index", index.Symbol, "error", err)
+		services.SendAndRecord(ctx, db, cfg, user, helper.PriceServiceUnavailableMessage(user.Locale))
+		c.JSON(http.StatusOK, gin.H{"status": "Price service unavailable"})
+		return
+	}
+	performance = services.SelectHorizons(performance, horizons(cfg, parsed))
+	services.SendAndRecord(ctx, db, cfg, user, helper.SingleStockPerformanceMessage(user.Locale, performance))
+	c.JSON(http.StatusOK, gin.H{"status": "Index response sent"})
+}
+
+func handleCompare(ctx context.Context, db *sql.DB, cfg *config.Config, quotes *services.QuoteChain, user *model.User, query string, c *gin.Context) {
+	logger := logging.FromContext(ctx)
+	names := services.ParseCompareQuery(query)
+	maxStocks := helper.AppConstant().MaxCompareStocks
+	if len(names) < 2 || len(names) > maxStocks {
+		services.SendAndRecord(ctx, db, cfg, user, helper.CompareUsageMessage(user.Locale, maxStocks))
+		c.JSON(http.StatusOK, gin.H{"status": "Compare usage sent"})
+		return
+	}
+
+	var stocks []model.StockPerformance
+	var unmatched, unpriced []string
+	for _, result := range services.CompareStocks(ctx, db, quotes, names) {
+		switch {
+		case result.Err == nil:
+			stocks = append(stocks, result.Performance)
+		case errors.Is(result.Err, services.ErrNoMatch) || errors.Is(result.Err, services.ErrAmbiguous):
+			unmatched = append(unmatched, strings.ToUpper(result.Query))
+		default:
+			logger.Error("failed to price compared stock", "query", result.Query, "error", result.Err)
+			unpriced = append(unpriced, strings.ToUpper(result.Query))
+		}
+	}
+
+	switch {
+	case len(stocks) > 0:
+		services.SendAndRecord(ctx, db, cfg, user, helper.CompareMessage(user.Locale, stocks, unmatched, unpriced))
+	case len(unpriced) > 0:
+		services.SendAndRecord(ctx, db, cfg, user, helper.PriceServiceUnavailableMessage(user.Locale))
+	default:
+		services.SendAndRecord(ctx, db, cfg, user, helper.NoStockFoundMessage(user.Locale))
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "Comparison sent"})
+}
+
+// handleTrade records a buy or sell the user typed, e.g. "tcs 10 @ 3500 on 12-03-2024"
+func handleTrade(ctx context.Context, db *sql.DB, cfg *config.Config, user *model.User, side, query string, c *gin.Context) {
+	logger := logging.FromContext(ctx)
+	trade, err := services.ParseTrade(query, time.Now())
+	if err != nil {
+		services.SendAndRecord(ctx, db, cfg, user, helper.TradeUsageMessage(user.Locale))
+		c.JSON(http.StatusOK, gin.H{"status": "Trade usage sent"})
+		return
+	}
+
+	matches, err := services.SearchStocks(ctx, db, trade.Stock.Text, trade.Stock.Exchange)
+	if err != nil {
+		logger.Error("stock search failed", "query", trade.Stock.Text, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	companies := services.GroupListings(matches)
+	switch {
+	case len(companies) == 0 || companies[0][0].Exchange == services.ExchangeIndex:
+		services.SendAndRecord(ctx, db, cfg, user, helper.NoStockFoundMessage(user.Locale))
+		c.JSON(http.StatusOK, gin.H{"status": "Stock not found"})
+		return
+	case len(companies) > 1:
+		services.SendAndRecord(ctx, db, cfg, user, helper.TradeAmbiguousMessage(user.Locale, strings.ToUpper(trade.Stock.Text)))
+		c.JSON(http.StatusOK, gin.H{"status": "Stock ambiguous"})
+		return
+	}
+
+	stock := companies[0][0]
+	transaction := model.Transaction{
+		Symbol:   stock.Symbol,
+		Exchange: stock.Exchange,
+		ISIN:     stock.ISIN,
+		Side:     side,
+		Quantity: trade.Quantity,
+		Price:    trade.Price,
+		TradedOn: trade.TradedOn,
+	}
+	_, err = services.RecordTransactions(ctx, db, user, []model.Transaction{transaction})
+	var oversold *services.OversoldError
+	switch {
+	case errors.As(err, &oversold):
+		services.SendAndRecord(ctx, db, cfg, user, helper.OversoldMessage(user.Locale, oversold.Symbol, oversold.Held, oversold.Selling))
+		c.JSON(http.StatusOK, gin.H{"status": "Trade rejected"})
+		return
+	case err != nil:
+		logger.Error("failed to record trade", "symbol", stock.Symbol, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	services.SendAndRecord(ctx, db, cfg, user, helper.TradeRecordedMessage(user.Locale, transaction))
+	c.JSON(http.StatusOK, gin.H{"status": "Trade recorded"})
+}
+
+func handlePortfolio(ctx context.Context, db *sql.DB, cfg *config.Config, quotes *services.QuoteChain, user *model.User, c *gin.Context) {
+	transactions, err := services.ListTransactions(ctx, db, user)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to load transactions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	holdings, _, err := services.BuildHoldings(transactions)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to build holdings", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	portfolio := services.ValuePortfolio(ctx, quotes, holdings)
+	services.SendAndRecord(ctx, db, cfg, user, helper.PortfolioMessage(user.Locale, portfolio))
+	c.JSON(http.StatusOK, gin.H{"status": "Portfolio sent"})
+}
+
+// handleTaxReport sums up the capital gains of the financial year asked for,
+// e.g. "fy2025-26", with a link to download the details
+func handleTaxReport(ctx context.Context, db *sql.DB, cfg *config.Config, user *model.User, query string, c *gin.Context) {
+	now := time.Now()
+	fy, err := services.ParseFinancialYear(query, now)
+	if err != nil {
+		services.SendAndRecord(ctx, db, cfg, user, helper.TaxUsageMessage(user.Locale))
+		c.JSON(http.StatusOK, gin.H{"status": "Tax usage sent"})
+		return
+	}
+
+	report, err := services.CapitalGains(ctx, db, user, fy)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to build capital gains report", "year", fy, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var link string
+	if len(report.Gains) > 0 {
+		link, _ = services.TaxReportURL(cfg, user, fy, now)
+	}
+	services.SendAndRecord(ctx, db, cfg, user, helper.TaxReportMessage(user.Locale, report, link))
+	c.JSON(http.StatusOK, gin.H{"status": "Tax report sent"})
+}
+
+// handleImport previews a holdings or tradebook CSV the user attached; it is
+// only recorded once they confirm
+func handleImport(ctx context.Context, db *sql.DB, cfg *config.Config, user *model.User, mediaURL, contentType string, c *gin.Context) {
+	logger := logging.FromContext(ctx)
+	if !services.IsCSVMedia(contentType) {
+		services.SendAndRecord(ctx, db, cfg, user, helper.ImportUnreadableMessage(user.Locale))
+		c.JSON(http.StatusOK, gin.H{"status": "Attachment not a CSV"})
+		return
+	}
+
+	data, err := services.DownloadMedia(ctx, cfg, mediaURL, helper.AppConstant().MaxImportBytes)
+	if err != nil {
+		logger.Warn("failed to download attachment", "error", err)
+		services.SendAndRecord(ctx, db, cfg, user, helper.ImportUnreadableMessage(user.Locale))
+		c.JSON(http.StatusOK, gin.H{"status": "Attachment unreadable"})
+		return
+	}
+
+	pending, err := services.PrepareImport(ctx, db, user, bytes.NewReader(data))
+	switch {
+	case errors.Is(err, services.ErrUnknownFormat):
+		services.SendAndRecord(ctx, db, cfg, user, helper.ImportUnreadableMessage(user.Locale))
+		c.JSON(http.StatusOK, gin.H{"status": "Attachment unreadable"})
+		return
+	case err != nil:
+		logger.Error("failed to prepare import", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Info("import awaiting confirmation", "broker", pending.Broker, "kind", pending.Kind,
+		"transactions", len(pending.Transactions), "skipped", len(pending.Skipped))
+	services.SendAndRecord(ctx, db, cfg, user, helper.ImportPreviewMessage(user.Locale, pending))
+	c.JSON(http.StatusOK, gin.H{"status": "Import preview sent"})
+}
+
+func handleConfirmImport(ctx context.Context, db *sql.DB, cfg *config.Config, user *model.User, c *gin.Context) {
+	pending, recorded, err := services.ConfirmPendingImport(ctx, db, user)
+	var oversold *services.OversoldError
+	switch {
+	case errors.Is(err, services.ErrNoPendingImport):
+		services.SendAndRecord(ctx, db, cfg, user, helper.NoPendingImportMessage(user.Locale))
+		c.JSON(http.StatusOK, gin.H{"status": "No pending import"})
+		return
+	case errors.As(err, &oversold):
+		services.SendAndRecord(ctx, db, cfg, user, helper.OversoldMessage(user.Locale, oversold.Symbol, oversold.Held, oversold.Selling))
+		c.JSON(http.StatusOK, gin.H{"status": "Import rejected"})
+		return
+	case err != nil:
+		logging.FromContext(ctx).Error("failed to apply import", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	services.SendAndRecord(ctx, db, cfg, user, helper.ImportAppliedMessage(user.Locale, recorded, len(pending.Transactions)))
+	c.JSON(http.StatusOK, gin.H{"status": "Import applied"})
+}
+
+func handleCancelImport(ctx context.Context, db *sql.DB, cfg *config.Config, user *model.User, c *gin.Context) {
+	if _, err := services.GetPendingImport(ctx, db, user); errors.Is(err, services.ErrNoPendingImport) {
+		services.SendAndRecord(ctx, db, cfg, user, helper.NoPendingImportMessage(user.Locale))
+		c.JSON(http.StatusOK, gin.H{"status": "No pending import"})
+		return
+	}
+	if err := services.DeletePendingImport(ctx, db, user); err != nil {
+		logging.FromContext(ctx).Error("failed to cancel import", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	services.SendAndRecord(ctx, db, cfg, user, helper.ImportCancelledMessage(user.Locale))
+	c.JSON(http.StatusOK, gin.H{"status": "Import cancelled"})
+}
+
+// handleLanguage switches the user's replies to the language they name, or
+// lists the languages on offer when we don't know it
+func handleLanguage(ctx context.Context, db *sql.DB, cfg *config.Config, user *model.User, name string, c *gin.Context) {
+	locale, ok := i18n.ParseLanguage(name)
+	if !ok {
+		services.SendAndRecord(ctx, db, cfg, user, helper.LanguageUnknownMessage(user.Locale))
+		c.JSON(http.StatusOK, gin.H{"status": "Language not supported"})
+		return
+	}
+
+	if err := services.SetUserLocale(ctx, db, user, locale); err != nil {
+		logging.FromContext(ctx).Error("failed to store locale", "locale", locale, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	services.SendAndRecord(ctx, db, cfg, user, helper.LanguageSetMessage(locale))
+	c.JSON(http.StatusOK, gin.H{"status": "Language updated"})
+}
+
+// horizons are the performance horizons to show: the ones asked for, or the configured default
+func horizons(cfg *config.Config, query services.StockQuery) []string {
+	if len(query.Horizons) > 0 {
+		return query.Horizons
+	}
+	return cfg.PerformanceHorizons
+}
+
+// firstListings picks one listing per company to offer as a choice
+func firstListings(companies [][]model.Stock) []model.Stock {
+	stocks := make([]model.Stock, 0, len(companies))
+	for _, listings := range companies {
+		stocks = append(stocks, listings[0])
+	}
+	return stocks
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
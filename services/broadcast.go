@@ -0,0 +1,442 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"stocks-info-channel/config"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/market"
+	"stocks-info-channel/model"
+
+	"github.com/lib/pq"
+	"golang.org/x/time/rate"
+)
+
+// Broadcast statuses
+const (
+	BroadcastScheduled = "scheduled"
+	BroadcastSending   = "sending"
+	BroadcastPaused    = "paused"
+	BroadcastCompleted = "completed"
+)
+
+// Broadcast segment types
+const (
+	SegmentAll      = "all"
+	SegmentWatchers = "watchers"
+	SegmentActive   = "active"
+)
+
+// Recipient delivery statuses
+const (
+	RecipientPending = "pending"
+	RecipientSent    = "sent"
+	RecipientFailed  = "failed"
+)
+
+var (
+	// ErrInvalidSegment is returned for an unknown or incomplete broadcast segment
+	ErrInvalidSegment = errors.New("invalid broadcast segment")
+	// ErrBroadcastState is returned when a broadcast can't be paused or resumed from its current status
+	ErrBroadcastState = errors.New("broadcast cannot change to that status")
+)
+
+// broadcastStaleAfter is how long a sending broadcast may go without a
+// heartbeat before another instance takes it over
+const broadcastStaleAfter = 5 * time.Minute
+
+const broadcastColumns = `id, body, template_sid, template_variables,
+	segment_type, segment_symbol, segment_days, rate_per_minute, status, send_at,
+	total_recipients, sent_count, failed_count, created_at, completed_at`
+
+// segmentCondition selects the users of a segment given as $1 type, $2 symbol, $3 days
+const segmentCondition = `is_subscribed
+	AND ($1 <> 'watchers' OR UPPER($2) = ANY(subscribed_stocks))
+	AND ($1 <> 'active' OR last_message_time >= NOW() - make_interval(days => $3::int))`
+
+func scanBroadcast(row interface{ Scan(...any) error }) (*model.Broadcast, error) {
+	var b model.Broadcast
+	var variables []byte
+	var completedAt sql.NullTime
+	err := row.Scan(&b.ID, &b.Body, &b.TemplateSid, &variables,
+		&b.Segment.Type, &b.Segment.Symbol, &b.Segment.Days, &b.RatePerMinute, &b.Status, &b.SendAt,
+		&b.TotalRecipients, &b.SentCount, &b.FailedCount, &b.CreatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(variables, &b.TemplateVariables); err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		b.CompletedAt = &completedAt.Time
+	}
+	return &b, nil
+}
+
+// ValidateSegment checks that segment names a known type with the values it needs
+func ValidateSegment(segment model.BroadcastSegment) error {
+	switch segment.Type {
+	case SegmentAll:
+		return nil
+	case SegmentWatchers:
+		if segment.Symbol == "" {
+			return fmt.Errorf("%w: watchers needs a symbol", ErrInvalidSegment)
+		}
+		return nil
+	case SegmentActive:
+		if segment.Days <= 0 {
+			return fmt.Errorf("%w: active needs a positive number of days", ErrInvalidSegment)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidSegment, segment.Type)
+	}
+}
+
+// CountSegmentUsers returns how many users a broadcast to segment would reach
+func CountSegmentUsers(ctx context.Context, db *sql.DB, segment model.BroadcastSegment) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE `+segmentCondition,
+		segment.Type, segment.Symbol, segment.Days).Scan(&n)
+	return n, err
+}
+
+// ScheduleBroadcast stores b to be sent once b.SendAt has passed
+func ScheduleBroadcast(ctx context.Context, db *sql.DB, b *model.Broadcast) (*model.Broadcast, error) {
+	if err := ValidateSegment(b.Segment); err != nil {
+		return nil, err
+	}
+	if b.RatePerMinute <= 0 {
+		return nil, errors.New("broadcast rate must be at least one message per minute")
+	}
+	variables, err := json.Marshal(b.TemplateVariables)
+	if err != nil {
+		return nil, err
+	}
+	if b.SendAt.IsZero() {
+		b.SendAt = time.Now()
+	}
+
+	return scanBroadcast(db.QueryRowContext(ctx, `
+		INSERT INTO broadcasts (body, template_sid, template_variables,
+			segment_type, segment_symbol, segment_days, rate_per_minute, send_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+broadcastColumns,
+		b.Body, b.TemplateSid, variables,
+		b.Segment.Type, b.Segment.Symbol, b.Segment.Days, b.RatePerMinute, b.SendAt))
+}
+
+// GetBroadcast loads one broadcast, returning sql.ErrNoRows when there is none
+func GetBroadcast(ctx context.Context, db *sql.DB, id int64) (*model.Broadcast, error) {
+	return scanBroadcast(db.QueryRowContext(ctx, `SELECT `+broadcastColumns+` FROM broadcasts WHERE id = $1`, id))
+}
+
+// ListBroadcasts returns the latest broadcasts first
+func ListBroadcasts(ctx context.Context, db *sql.DB, limit, offset int) ([]*model.Broadcast, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+broadcastColumns+` FROM broadcasts
+		ORDER BY created_at DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var broadcasts []*model.Broadcast
+	for rows.Next() {
+		b, err := scanBroadcast(rows)
+		if err != nil {
+			return nil, err
+		}
+		broadcasts = append(broadcasts, b)
+	}
+	return broadcasts, rows.Err()
+}
+
+// ListBroadcastRecipients returns the per-user results of a broadcast,
+// optionally only those with status
+func ListBroadcastRecipients(ctx context.Context, db *sql.DB, id int64, status string, limit, offset int) ([]model.BroadcastRecipient, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.user_id, u.phone_number, r.status, r.error, r.attempted_at
+		FROM broadcast_recipients r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.broadcast_id = $1 AND ($2 = '' OR r.status = $2)
+		ORDER BY r.attempted_at DESC NULLS LAST, u.phone_number
+		LIMIT $3 OFFSET $4
+	`, id, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []model.BroadcastRecipient
+	for rows.Next() {
+		var r model.BroadcastRecipient
+		var attemptedAt sql.NullTime
+		if err := rows.Scan(&r.UserID, &r.PhoneNumber, &r.Status, &r.Error, &attemptedAt); err != nil {
+			return nil, err
+		}
+		if attemptedAt.Valid {
+			r.AttemptedAt = &attemptedAt.Time
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// PauseBroadcast stops a scheduled or sending broadcast after its current message
+func PauseBroadcast(ctx context.Context, db *sql.DB, id int64) error {
+	return setBroadcastStatus(ctx, db, id, BroadcastPaused, BroadcastScheduled, BroadcastSending)
+}
+
+// ResumeBroadcast reschedules a paused broadcast; only users not yet tried are sent to
+func ResumeBroadcast(ctx context.Context, db *sql.DB, id int64) error {
+	return setBroadcastStatus(ctx, db, id, BroadcastScheduled, BroadcastPaused)
+}
+
+func setBroadcastStatus(ctx context.Context, db *sql.DB, id int64, status string, from ...string) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE broadcasts SET status = $2 WHERE id = $1 AND status = ANY($3)
+	`, id, status, pq.StringArray(from))
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrBroadcastState
+	}
+	return nil
+}
+
+// RunBroadcastScheduler sends due broadcasts, checking every interval until ctx is done
+func RunBroadcastScheduler(ctx context.Context, db *sql.DB, cfg *config.Config, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			b, err := claimDueBroadcast(ctx, db)
+			if err == sql.ErrNoRows {
+				break
+			}
+			if err != nil {
+				logging.FromContext(ctx).Error("failed to claim due broadcast", "error", err)
+				break
+			}
+			now := time.Now()
+			if isMarketSegment(b.Segment) && !market.IsTradingDay(now) {
+				if next := market.NextOpen(now); !next.IsZero() {
+					postponeBroadcast(ctx, db, b, next)
+					continue
+				}
+			}
+			if !deliverBroadcast(ctx, db, cfg, b) {
+				break
+			}
+		}
+	}
+}
+
+// isMarketSegment reports whether a broadcast to segment is about the market,
+// so it waits for a trading day. Watchers get news about the stock they
+// follow; "all" and "active" broadcasts are service announcements and go out
+// any day.
+func isMarketSegment(segment model.BroadcastSegment) bool {
+	return segment.Type == SegmentWatchers
+}
+
+// claimDueBroadcast marks the oldest due broadcast as sending, so that only one
+// instance of the service delivers it. A sending broadcast whose heartbeat has
+// gone stale was abandoned by a crashed instance and is claimed again.
+func claimDueBroadcast(ctx context.Context, db *sql.DB) (*model.Broadcast, error) {
+	return scanBroadcast(db.QueryRowContext(ctx, `
+		UPDATE broadcasts SET status = $1, heartbeat_at = NOW()
+		WHERE id = (
+			SELECT id FROM broadcasts
+			WHERE (status = $2 AND send_at <= NOW())
+			   OR (status = $1 AND heartbeat_at < NOW() - make_interval(secs => $3))
+			ORDER BY send_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+broadcastColumns,
+		BroadcastSending, BroadcastScheduled, broadcastStaleAfter.Seconds()))
+}
+
+// deliverBroadcast sends b to its pending recipients at b.RatePerMinute. It
+// stops when the broadcast is paused, and on shutdown or database errors hands
+// it back to the scheduler so it resumes where it left off. It reports whether
+// the scheduler can go on to the next due broadcast.
+func deliverBroadcast(ctx context.Context, db *sql.DB, cfg *config.Config, b *model.Broadcast) bool {
+	logger := logging.FromContext(ctx).With("broadcast_id", b.ID)
+	ctx = logging.WithLogger(ctx, logger)
+
+	if err := addBroadcastRecipients(ctx, db, b); err != nil {
+		logger.Error("failed to load broadcast recipients", "error", err)
+		releaseBroadcast(ctx, db, b)
+		return false
+	}
+
+	limiter := rate.NewLimiter(rate.Every(time.Minute/time.Duration(b.RatePerMinute)), 1)
+	template := model.TemplateMessage{ContentSid: b.TemplateSid, Variables: b.TemplateVariables}
+	logger.Info("delivering broadcast", "recipients", b.TotalRecipients, "rate_per_minute", b.RatePerMinute)
+
+	for {
+		users, err := pendingBroadcastRecipients(ctx, db, b.ID, 50)
+		if err != nil {
+			logger.Error("failed to load pending recipients", "error", err)
+			releaseBroadcast(ctx, db, b)
+			return false
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		for _, user := range users {
+			if err := limiter.Wait(ctx); err != nil {
+				logger.Warn("broadcast interrupted by shutdown, it will resume later")
+				releaseBroadcast(ctx, db, b)
+				return false
+			}
+
+			_, sendErr := SendProactiveWhatsApp(ctx, cfg, user, b.Body, template)
+			status, recordErr := recordBroadcastResult(ctx, db, b, user, sendErr)
+			if sendErr == nil {
+				if err := RecordMessage(ctx, db, user, DirectionOutbound, b.Body); err != nil {
+					logger.Warn("failed to record broadcast message", "user_id", user.ID, "error", err)
+				}
+			}
+			// The recipient is still pending, so carrying on would send to them
+			// again in the next batch; stop until the database recovers
+			if recordErr != nil {
+				logger.Error("failed to record broadcast result", "user_id", user.ID, "error", recordErr)
+				releaseBroadcast(ctx, db, b)
+				return false
+			}
+			if status == BroadcastPaused {
+				logger.Info("broadcast paused")
+				return true
+			}
+		}
+	}
+
+	logger.Info("broadcast delivered")
+	if _, err := db.ExecContext(context.WithoutCancel(ctx), `
+		UPDATE broadcasts SET status = $2, completed_at = NOW()
+		WHERE id = $1 AND status = $3
+	`, b.ID, BroadcastCompleted, BroadcastSending); err != nil {
+		logger.Error("failed to complete broadcast", "error", err)
+	}
+	return true
+}
+
+// addBroadcastRecipients snapshots the segment into broadcast_recipients the
+// first time b is sent, so a resumed broadcast keeps its original audience
+func addBroadcastRecipients(ctx context.Context, db *sql.DB, b *model.Broadcast) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO broadcast_recipients (broadcast_id, user_id)
+		SELECT $4, id FROM users
+		WHERE `+segmentCondition+`
+		  AND NOT EXISTS (SELECT 1 FROM broadcast_recipients WHERE broadcast_id = $4)
+	`, b.Segment.Type, b.Segment.Symbol, b.Segment.Days, b.ID)
+	if err != nil {
+		return err
+	}
+	return db.QueryRowContext(ctx, `
+		UPDATE broadcasts
+		SET total_recipients = (SELECT COUNT(*) FROM broadcast_recipients WHERE broadcast_id = $1)
+		WHERE id = $1
+		RETURNING total_recipients
+	`, b.ID).Scan(&b.TotalRecipients)
+}
+
+// pendingBroadcastRecipients returns up to limit users not yet tried
+func pendingBroadcastRecipients(ctx context.Context, db *sql.DB, id int64, limit int) ([]*model.User, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+userColumns+` FROM users
+		WHERE id IN (
+			SELECT user_id FROM broadcast_recipients
+			WHERE broadcast_id = $1 AND status = $2
+		)
+		ORDER BY id
+		LIMIT $3
+	`, id, RecipientPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// recordBroadcastResult stores one recipient's outcome, bumps the broadcast's
+// counters and heartbeat, and returns the broadcast's current status. It is
+// saved even while shutting down.
+func recordBroadcastResult(ctx context.Context, db *sql.DB, b *model.Broadcast, user *model.User, sendErr error) (string, error) {
+	status, errText := RecipientSent, ""
+	if sendErr != nil {
+		status, errText = RecipientFailed, sendErr.Error()
+	}
+
+	var broadcastStatus string
+	err := db.QueryRowContext(context.WithoutCancel(ctx), `
+		WITH result AS (
+			UPDATE broadcast_recipients SET status = $3, error = $4, attempted_at = NOW()
+			WHERE broadcast_id = $1 AND user_id = $2 AND status = 'pending'
+			RETURNING status
+		)
+		UPDATE broadcasts SET
+			sent_count = sent_count + (SELECT COUNT(*) FROM result WHERE status = 'sent'),
+			failed_count = failed_count + (SELECT COUNT(*) FROM result WHERE status = 'failed'),
+			heartbeat_at = NOW()
+		WHERE id = $1
+		RETURNING status
+	`, b.ID, user.ID, status, errText).Scan(&broadcastStatus)
+	return broadcastStatus, err
+}
+
+// postponeBroadcast hands a claimed broadcast back to the scheduler, due at until
+func postponeBroadcast(ctx context.Context, db *sql.DB, b *model.Broadcast, until time.Time) {
+	logger := logging.FromContext(ctx).With("broadcast_id", b.ID)
+	_, err := db.ExecContext(context.WithoutCancel(ctx), `
+		UPDATE broadcasts SET status = $2, send_at = $3 WHERE id = $1 AND status = $4
+	`, b.ID, BroadcastScheduled, until, BroadcastSending)
+	if err != nil {
+		logger.Error("failed to postpone broadcast", "error", err)
+		return
+	}
+	logger.Info("market closed today, broadcast postponed", "send_at", until)
+}
+
+// releaseBroadcast hands a sending broadcast back to the scheduler
+func releaseBroadcast(ctx context.Context, db *sql.DB, b *model.Broadcast) {
+	_, err := db.ExecContext(context.WithoutCancel(ctx), `
+		UPDATE broadcasts SET status = $2 WHERE id = $1 AND status = $3
+	`, b.ID, BroadcastScheduled, BroadcastSending)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to release broadcast", "error", err)
+	}
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Kinds of broker export
+const (
+	ImportHoldings  = "holdings"
+	ImportTradebook = "tradebook"
+)
+
+// ErrUnknownFormat is returned for a CSV that isn't a broker export we know
+var ErrUnknownFormat = errors.New("unrecognised broker export")
+
+// maxImportRows bounds how many rows one export may have
+const maxImportRows = 5000
+
+// headerSearchRows is how far down an export its header may be; Groww and
+// Upstox put a block of account details above it
+const headerSearchRows = 30
+
+// Columns an export row can carry
+const (
+	colSymbol   = "symbol"
+	colISIN     = "isin"
+	colName     = "name"
+	colExchange = "exchange"
+	colSide     = "side"
+	colQuantity = "quantity"
+	colPrice    = "price"
+	colValue    = "value" // total value, when there is no price column
+	colDate     = "date"
+	colTradeID  = "trade_id"
+	colStatus   = "status"
+)
+
+// brokerFormat recognises one broker export by its header. Header names are
+// compared lowercase with everything but letters and digits removed.
+type brokerFormat struct {
+	broker   string
+	kind     string
+	columns  map[string][]string // header names of each column, most likely first
+	required []string
+}
+
+// brokerFormats are tried in order; the first whose required columns are all
+// present wins, so more specific formats come first
+var brokerFormats = []brokerFormat{
+	{
+		broker: "Zerodha",
+		kind:   ImportTradebook,
+		columns: map[string][]string{
+			colSymbol: {"symbol"}, colISIN: {"isin"}, colExchange: {"exchange"},
+			colSide: {"tradetype"}, colQuantity: {"quantity"}, colPrice: {"price"},
+			colDate: {"tradedate"}, colTradeID: {"tradeid"},
+		},
+		required: []string{colSymbol, colSide, colQuantity, colPrice, colDate, colTradeID},
+	},
+	{
+		broker: "Upstox",
+		kind:   ImportTradebook,
+		columns: map[string][]string{
+			colName: {"company", "scripname"}, colSymbol: {"symbol", "scripcode"}, colISIN: {"isin"},
+			colExchange: {"exchange"}, colSide: {"side", "buysell"}, colQuantity: {"quantity", "qty"},
+			colPrice: {"price", "tradeprice"}, colDate: {"date", "tradedate"}, colTradeID: {"tradenum", "tradeno", "tradenumber"},
+		},
+		required: []string{colSide, colQuantity, colPrice, colDate, colTradeID},
+	},
+	{
+		broker: "Groww",
+		kind:   ImportTradebook,
+		columns: map[string][]string{
+			colName: {"stockname"}, colSymbol: {"symbol"}, colISIN: {"isin"}, colExchange: {"exchange"},
+			colSide: {"type"}, colQuantity: {"quantity"}, colValue: {"value"},
+			colDate: {"executiondateandtime"}, colTradeID: {"exchangeorderid"}, colStatus: {"orderstatus"},
+		},
+		required: []string{colSide, colQuantity, colValue, colDate},
+	},
+	{
+		broker: "Zerodha",
+		kind:   ImportHoldings,
+		columns: map[string][]string{
+			colSymbol: {"instrument", "symbol"}, colISIN: {"isin"},
+			colQuantity: {"qty", "quantityavailable"}, colPrice: {"avgcost", "averageprice"},
+		},
+		required: []string{colSymbol, colQuantity, colPrice},
+	},
+	{
+		broker: "Groww",
+		kind:   ImportHoldings,
+		columns: map[string][]string{
+			colName: {"stockname"}, colISIN: {"isin"}, colQuantity: {"quantity"}, colPrice: {"averagebuyprice"},
+		},
+		required: []string{colISIN, colQuantity, colPrice},
+	},
+	{
+		broker: "Upstox",
+		kind:   ImportHoldings,
+		columns: map[string][]string{
+			colName: {"companyname", "scripname", "company"}, colSymbol: {"symbol"}, colISIN: {"isin"},
+			colQuantity: {"qty", "quantity", "netqty"}, colPrice: {"avgprice", "averageprice"},
+		},
+		required: []string{colISIN, colQuantity, colPrice},
+	},
+}
+
+// brokerDateLayouts are the date formats seen in broker exports
+var brokerDateLayouts = []string{
+	"2006-01-02", "02-01-2006", "02/01/2006", "2-1-2006", "2/1/2006", "02-Jan-2006", "02 Jan 2006",
+	"2006-01-02 15:04:05", "2006-01-02T15:04:05", "02-01-2006 15:04", "02-01-2006 15:04:05",
+	"02/01/2006 15:04:05", "02 Jan 2006, 03:04 PM", "02-01-2006 03:04 PM",
+}
+
+// BrokerRow is one trade or holding read from a broker export. Holdings have
+// no trade date and are always buys.
+type BrokerRow struct {
+	Line     int
+	Symbol   string
+	ISIN     string
+	Name     string
+	Exchange string
+	Side     string
+	Quantity float64
+	Price    float64
+	TradedOn time.Time
+	TradeID  string
+}
+
+// BrokerExport is a parsed broker export. Skipped describes rows that were
+// left out, such as cancelled orders.
+type BrokerExport struct {
+	Broker  string
+	Kind    string
+	Rows    []BrokerRow
+	Skipped []string
+}
+
+// ParseBrokerCSV recognises a Zerodha, Groww or Upstox holdings or tradebook
+// CSV export and reads its rows
+func ParseBrokerCSV(r io.Reader) (BrokerExport, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return BrokerExport{}, err
+	}
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var format *brokerFormat
+	var columns map[string]int
+	for line := 1; format == nil; line++ {
+		record, err := reader.Read()
+		if err == io.EOF || line > headerSearchRows {
+			return BrokerExport{}, ErrUnknownFormat
+		} else if err != nil {
+			return BrokerExport{}, err
+		}
+		format, columns = matchBrokerFormat(record)
+	}
+
+	export := BrokerExport{Broker: format.broker, Kind: format.kind}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return BrokerExport{}, err
+		}
+		line, _ := reader.FieldPos(0)
+		if isBlankRecord(record) {
+			continue
+		}
+		if len(export.Rows)+len(export.Skipped) >= maxImportRows {
+			return BrokerExport{}, fmt.Errorf("export has more than %d rows", maxImportRows)
+		}
+
+		row, skip := parseBrokerRow(format, columns, record)
+		row.Line = line
+		if skip != "" {
+			export.Skipped = append(export.Skipped, fmt.Sprintf("row %d: %s", line, skip))
+			continue
+		}
+		export.Rows = append(export.Rows, row)
+	}
+	return export, nil
+}
+
+// matchBrokerFormat finds the format whose header record is, and where each of its columns is
+func matchBrokerFormat(record []string) (*brokerFormat, map[string]int) {
+	position := make(map[string]int, len(record))
+	for i, name := range record {
+		if _, ok := position[headerKey(name)]; !ok {
+			position[headerKey(name)] = i
+		}
+	}
+
+	for i := range brokerFormats {
+		format := &brokerFormats[i]
+		columns := make(map[string]int)
+		for column, names := range format.columns {
+			for _, name := range names {
+				if at, ok := position[name]; ok {
+					columns[column] = at
+					break
+				}
+			}
+		}
+		complete := true
+		for _, column := range format.required {
+			if _, ok := columns[column]; !ok {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			return format, columns
+		}
+	}
+	return nil, nil
+}
+
+// parseBrokerRow reads a record, or says why it was skipped
+func parseBrokerRow(format *brokerFormat, columns map[string]int, record []string) (BrokerRow, string) {
+	field := func(column string) string {
+		if at, ok := columns[column]; ok && at < len(record) {
+			return strings.TrimSpace(record[at])
+		}
+		return ""
+	}
+
+	row := BrokerRow{
+		Symbol:   strings.ToUpper(field(colSymbol)),
+		ISIN:     strings.ToUpper(field(colISIN)),
+		Name:     field(colName),
+		Exchange: strings.ToUpper(field(colExchange)),
+		Side:     SideBuy,
+		TradeID:  field(colTradeID),
+	}
+	label := cmp.Or(row.Symbol, row.Name, row.ISIN)
+	if label == "" {
+		// Totals and footers have no instrument
+		return row, "no stock named"
+	}
+	if status := strings.ToLower(field(colStatus)); status != "" && status != "executed" && status != "complete" {
+		return row, fmt.Sprintf("%s order was %s", label, status)
+	}
+
+	var err error
+	if row.Quantity, err = parseAmount(field(colQuantity)); err != nil || row.Quantity <= 0 {
+		return row, fmt.Sprintf("%s has no quantity", label)
+	}
+	if _, ok := columns[colPrice]; ok {
+		row.Price, err = parseAmount(field(colPrice))
+	} else {
+		var value float64
+		value, err = parseAmount(field(colValue))
+		row.Price = value / row.Quantity
+	}
+	if err != nil || row.Price < 0 {
+		return row, fmt.Sprintf("%s has no price", label)
+	}
+
+	if format.kind == ImportTradebook {
+		switch strings.ToLower(field(colSide)) {
+		case "buy", "b":
+			row.Side = SideBuy
+		case "sell", "s":
+			row.Side = SideSell
+		default:
+			return row, fmt.Sprintf("%s is neither a buy nor a sell", label)
+		}
+		if row.TradedOn, err = parseBrokerDate(field(colDate)); err != nil {
+			return row, fmt.Sprintf("%s has an unreadable date %q", label, field(colDate))
+		}
+	}
+	return row, ""
+}
+
+func parseBrokerDate(s string) (time.Time, error) {
+	for _, layout := range brokerDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format %q", s)
+}
+
+// parseAmount reads a number that may carry a rupee sign and Indian digit grouping
+func parseAmount(s string) (float64, error) {
+	s = strings.NewReplacer(",", "", "₹", "", " ", "").Replace(s)
+	return strconv.ParseFloat(s, 64)
+}
+
+func headerKey(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
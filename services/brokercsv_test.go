@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBrokerCSV(t *testing.T) {
+	tests := []struct {
+		name        string
+		csv         string
+		wantBroker  string
+		wantKind    string
+		wantRows    []BrokerRow
+		wantSkipped []string
+	}{
+		{
+			name: "Zerodha tradebook",
+			csv: "\ufeffsymbol,isin,trade_date,exchange,segment,series,trade_type,auction,quantity,price,trade_id,order_id,order_execution_time\n" +
+				"TCS,INE467B01029,2024-03-12,NSE,EQ,EQ,buy,false,10,3500.50,5551,1001,2024-03-12T10:00:00\n" +
+				"INFY,INE009A01021,2024-04-01,BSE,EQ,A,sell,false,5,1500,5552,1002,2024-04-01T11:30:00\n",
+			wantBroker: "Zerodha",
+			wantKind:   ImportTradebook,
+			wantRows: []BrokerRow{
+				{Line: 2, Symbol: "TCS", ISIN: "INE467B01029", Exchange: "NSE", Side: SideBuy, Quantity: 10, Price: 3500.5, TradedOn: day(2024, time.March, 12), TradeID: "5551"},
+				{Line: 3, Symbol: "INFY", ISIN: "INE009A01021", Exchange: "BSE", Side: SideSell, Quantity: 5, Price: 1500, TradedOn: day(2024, time.April, 1), TradeID: "5552"},
+			},
+		},
+		{
+			name: "Zerodha holdings",
+			csv: "Instrument,Qty.,Avg. cost,LTP,Cur. val,P&L,Net chg.,Day chg.\n" +
+				"TCS,10,3300,3500,35000,2000,6.06,0.5\n" +
+				"RELIANCE,4,\"2,450.25\",2900,11600,1799,18.35,-0.2\n",
+			wantBroker: "Zerodha",
+			wantKind:   ImportHoldings,
+			wantRows: []BrokerRow{
+				{Line: 2, Symbol: "TCS", Side: SideBuy, Quantity: 10, Price: 3300},
+				{Line: 3, Symbol: "RELIANCE", Side: SideBuy, Quantity: 4, Price: 2450.25},
+			},
+		},
+		{
+			name: "Groww orders",
+			csv: "Stock name,Symbol,ISIN,Type,Quantity,Value,Exchange,Exchange Order Id,Execution date and time,Order status\n" +
+				"Tata Consultancy Services,TCS,INE467B01029,BUY,2,7000,NSE,111,12-03-2024 10:15 AM,Executed\n" +
+				"Tata Consultancy Services,TCS,INE467B01029,BUY,2,7000,NSE,112,12-03-2024 10:20 AM,Cancelled\n",
+			wantBroker: "Groww",
+			wantKind:   ImportTradebook,
+			wantRows: []BrokerRow{
+				{Line: 2, Symbol: "TCS", ISIN: "INE467B01029", Name: "Tata Consultancy Services", Exchange: "NSE", Side: SideBuy, Quantity: 2, Price: 3500, TradedOn: day(2024, time.March, 12), TradeID: "111"},
+			},
+			wantSkipped: []string{"row 3: TCS order was cancelled"},
+		},
+		{
+			name: "Groww holdings with account details above the header",
+			csv: "Name,Asha Rao\nUnique Client Code,1234567\n\n" +
+				"Stock Name,ISIN,Quantity,Average buy price,Buy value,Closing price,Closing value,Unrealised P&L\n" +
+				"Tata Consultancy Services,INE467B01029,4,3400,13600,3500,14000,400\n" +
+				"Total,,,,13600,,14000,400\n",
+			wantBroker: "Groww",
+			wantKind:   ImportHoldings,
+			wantRows: []BrokerRow{
+				{Line: 5, ISIN: "INE467B01029", Name: "Tata Consultancy Services", Side: SideBuy, Quantity: 4, Price: 3400},
+			},
+			wantSkipped: []string{"row 6: Total has no quantity"},
+		},
+		{
+			name: "Upstox tradebook",
+			csv: "Date,Company,Amount,Exchange,Segment,Scrip Code,Instrument Type,Strike Price,Expiry,Trade Num,Trade Time,Side,Quantity,Price\n" +
+				"15-05-2024,INFOSYS LTD,14500,NSE,EQ,INFY,EQUITY,,,88001,10:01:02,Buy,10,1450\n" +
+				"20-05-2024,INFOSYS LTD,4600,NSE,EQ,INFY,EQUITY,,,88002,14:30:00,Sell,3,1533.33\n",
+			wantBroker: "Upstox",
+			wantKind:   ImportTradebook,
+			wantRows: []BrokerRow{
+				{Line: 2, Symbol: "INFY", Name: "INFOSYS LTD", Exchange: "NSE", Side: SideBuy, Quantity: 10, Price: 1450, TradedOn: day(2024, time.May, 15), TradeID: "88001"},
+				{Line: 3, Symbol: "INFY", Name: "INFOSYS LTD", Exchange: "NSE", Side: SideSell, Quantity: 3, Price: 1533.33, TradedOn: day(2024, time.May, 20), TradeID: "88002"},
+			},
+		},
+		{
+			name: "Upstox holdings",
+			csv: "Company Name,ISIN,Qty,Avg Price,LTP,Current Value,P&L\n" +
+				"HDFC BANK LTD,INE040A01034,12,1520.40,1650,19800,1555.2\n",
+			wantBroker: "Upstox",
+			wantKind:   ImportHoldings,
+			wantRows: []BrokerRow{
+				{Line: 2, ISIN: "INE040A01034", Name: "HDFC BANK LTD", Side: SideBuy, Quantity: 12, Price: 1520.4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export, err := ParseBrokerCSV(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatalf("ParseBrokerCSV: %v", err)
+			}
+			if export.Broker != tt.wantBroker || export.Kind != tt.wantKind {
+				t.Errorf("recognised %s %s, want %s %s", export.Broker, export.Kind, tt.wantBroker, tt.wantKind)
+			}
+			if !reflect.DeepEqual(export.Rows, tt.wantRows) {
+				t.Errorf("rows:\n got %+v\nwant %+v", export.Rows, tt.wantRows)
+			}
+			if !reflect.DeepEqual(export.Skipped, tt.wantSkipped) {
+				t.Errorf("skipped = %q, want %q", export.Skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestParseBrokerCSVUnknownFormat(t *testing.T) {
+	for _, csv := range []string{
+		"",
+		"foo,bar\n1,2\n",
+		"Date,Description,Debit,Credit,Balance\n01-04-2024,Opening balance,,,1000\n",
+	} {
+		if _, err := ParseBrokerCSV(strings.NewReader(csv)); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("ParseBrokerCSV(%q) error = %v, want ErrUnknownFormat", csv, err)
+		}
+	}
+}
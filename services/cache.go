@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"stocks-info-channel/model"
+)
+
+// quotes keeps recent provider responses so repeated lookups of the same
+// symbol don't each cost an upstream request
+var quotes = &quoteCache{entries: make(map[string]cachedQuote)}
+
+type cachedQuote struct {
+	response  model.StockAPIResponse
+	source    string
+	fetchedAt time.Time
+	expiresAt time.Time
+}
+
+type quoteCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedQuote
+}
+
+func (q *quoteCache) get(symbol string) (cachedQuote, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.entries[symbol]
+	if !ok {
+		return cachedQuote{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(q.entries, symbol)
+		return cachedQuote{}, false
+	}
+	return entry, true
+}
+
+// set stores a quote; a zero ttl disables caching
+func (q *quoteCache) set(symbol string, entry cachedQuote, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entry.expiresAt = entry.fetchedAt.Add(ttl)
+	q.entries[symbol] = entry
+}
+
+// RunQuoteCacheJanitor evicts expired quotes every interval until ctx is done
+func RunQuoteCacheJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			quotes.evictExpired(now)
+		}
+	}
+}
+
+func (q *quoteCache) evictExpired(now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for symbol, entry := range q.entries {
+		if now.After(entry.expiresAt) {
+			delete(q.entries, symbol)
+		}
+	}
+}
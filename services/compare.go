@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+
+	"stocks-info-channel/model"
+)
+
+var (
+	// ErrNoMatch is returned for a compared name that matches no stock
+	ErrNoMatch = errors.New("no matching stock")
+	// ErrAmbiguous is returned for a compared name that matches several companies
+	ErrAmbiguous = errors.New("matches several companies")
+)
+
+// ComparedStock is one name of a comparison and how it resolved. Err is
+// ErrNoMatch, ErrAmbiguous or the reason it couldn't be priced.
+type ComparedStock struct {
+	Query       string
+	Performance model.StockPerformance
+	Err         error
+}
+
+// compareSeparator splits names that may span several words, e.g. "tata motors vs infy"
+var compareSeparator = regexp.MustCompile(`(?i),|\s+vs\.?\s+`)
+
+// ParseCompareQuery splits the names to compare, dropping repeats. Names are
+// separated by commas or "vs" when either is used, so they can be several
+// words ("tata motors, infy"); otherwise every word is a name ("tcs infy").
+func ParseCompareQuery(query string) []string {
+	var parts []string
+	if compareSeparator.MatchString(query) {
+		parts = compareSeparator.Split(query, -1)
+	} else {
+		for _, word := range strings.Fields(query) {
+			if !strings.EqualFold(word, "and") {
+				parts = append(parts, word)
+			}
+		}
+	}
+
+	var names []string
+	for _, part := range parts {
+		name := strings.Join(strings.Fields(part), " ")
+		if name != "" && !containsFold(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// CompareStocks resolves each name through SearchStocks and prices the matches
+// concurrently. Results keep the order of names.
+func CompareStocks(ctx context.Context, db *sql.DB, chain *QuoteChain, names []string) []ComparedStock {
+	results := make([]ComparedStock, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = compareStock(ctx, db, chain, name)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func compareStock(ctx context.Context, db *sql.DB, chain *QuoteChain, name string) ComparedStock {
+	result := ComparedStock{Query: name}
+	matches, err := SearchStocks(ctx, db, name, "")
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	companies := GroupListings(matches)
+	switch len(companies) {
+	case 0:
+		result.Err = ErrNoMatch
+		return result
+	case 1:
+	default:
+		result.Err = ErrAmbiguous
+		return result
+	}
+
+	// One price per stock keeps the table narrow, so only the first listing is quoted
+	result.Performance, result.Err = GetStockPerformance(ctx, chain, companies[0][0])
+	return result
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
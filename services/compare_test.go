@@ -0,0 +1,29 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCompareQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"tcs infy", []string{"tcs", "infy"}},
+		{"tcs and infy", []string{"tcs", "infy"}},
+		{"tcs infy tcs", []string{"tcs", "infy"}},
+		{"tata motors, infy", []string{"tata motors", "infy"}},
+		{"tata motors,infy , hdfc bank", []string{"tata motors", "infy", "hdfc bank"}},
+		{"tata motors vs infy", []string{"tata motors", "infy"}},
+		{"larsen and toubro VS. tcs", []string{"larsen and toubro", "tcs"}},
+		{"tcs, TCS, infy,", []string{"tcs", "infy"}},
+		{"vsnl, tcs", []string{"vsnl", "tcs"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := ParseCompareQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCompareQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stocks-info-channel/market"
+	"stocks-info-channel/model"
+
+	"github.com/lib/pq"
+)
+
+// pendingImportTTL is how long an import waits for the user to confirm it
+const pendingImportTTL = 24 * time.Hour
+
+// holdingIDPrefix starts the ExternalID of a buy recorded from a holdings
+// file, which marks its purchase date as unknown
+const holdingIDPrefix = "holding:"
+
+// ErrNoPendingImport is returned when there is no import to confirm
+var ErrNoPendingImport = errors.New("no pending import")
+
+// PrepareImport parses a broker export for user and keeps what it would
+// add as their pending import; a holdings file only adds shares the user
+// hasn't recorded yet. An export that adds nothing is returned but not kept,
+// since there is nothing to confirm.
+func PrepareImport(ctx context.Context, db *sql.DB, user *model.User, r io.Reader) (model.PendingImport, error) {
+	export, err := ParseBrokerCSV(r)
+	if err != nil {
+		return model.PendingImport{}, err
+	}
+	pending, err := ResolveBrokerExport(ctx, db, export, time.Now())
+	if err != nil {
+		return pending, err
+	}
+	if pending.Kind == ImportHoldings {
+		existing, err := ListTransactions(ctx, db, user)
+		if err != nil {
+			return pending, err
+		}
+		if pending.AlreadyHeld, err = holdingsToRecord(existing, &pending); err != nil {
+			return pending, err
+		}
+	}
+	if len(pending.Transactions) == 0 {
+		return pending, nil
+	}
+	return pending, SavePendingImport(ctx, db, user, pending)
+}
+
+// ResolveBrokerExport maps the rows of export to listings, by ISIN where the
+// export has one and by symbol or BSE scrip code otherwise, and turns them
+// into transactions. Holdings have no trade date, so they are recorded as
+// bought on the day of the import, one buy per listing.
+func ResolveBrokerExport(ctx context.Context, db *sql.DB, export BrokerExport, now time.Time) (model.PendingImport, error) {
+	pending := model.PendingImport{
+		Broker:    export.Broker,
+		Kind:      export.Kind,
+		Skipped:   export.Skipped,
+		CreatedAt: now,
+	}
+
+	var isins []string
+	for _, row := range export.Rows {
+		if row.ISIN != "" {
+			isins = append(isins, row.ISIN)
+		}
+	}
+	byISIN, err := stocksByISIN(ctx, db, isins)
+	if err != nil {
+		return pending, err
+	}
+
+	today := market.In(now)
+	importDay := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	source := strings.ToLower(export.Broker)
+	holdingAt := make(map[string]int) // index of each company's holding in pending.Transactions
+	for _, row := range export.Rows {
+		stock, ok := byISIN[row.ISIN]
+		if !ok && row.Symbol != "" {
+			stock, ok, err = findListing(ctx, db, row.Symbol, row.Exchange)
+			if err != nil {
+				return pending, err
+			}
+		}
+		if !ok {
+			label := row.Symbol
+			if label == "" {
+				label = row.Name
+			}
+			pending.Skipped = append(pending.Skipped, fmt.Sprintf("row %d: %s isn't in our stock list", row.Line, label))
+			continue
+		}
+
+		transaction := model.Transaction{
+			Symbol:     stock.Symbol,
+			Exchange:   stock.Exchange,
+			ISIN:       stock.ISIN,
+			Side:       row.Side,
+			Quantity:   row.Quantity,
+			Price:      row.Price,
+			TradedOn:   row.TradedOn,
+			Source:     source,
+			ExternalID: row.TradeID,
+		}
+		if export.Kind == ImportHoldings {
+			transaction.TradedOn = importDay
+
+			// A company can span rows, e.g. free and pledged shares; they are
+			// one holding at their average cost
+			key := companyKey(transaction)
+			if i, ok := holdingAt[key]; ok {
+				held := &pending.Transactions[i]
+				quantity := held.Quantity + transaction.Quantity
+				held.Price = (held.Price*held.Quantity + transaction.Price*transaction.Quantity) / quantity
+				held.Quantity = quantity
+				continue
+			}
+			holdingAt[key] = len(pending.Transactions)
+		}
+		pending.Transactions = append(pending.Transactions, transaction)
+	}
+
+	// Exports list a day's trades in any order; delivery trades can't sell
+	// what wasn't bought, so buys go first
+	sort.SliceStable(pending.Transactions, func(i, j int) bool {
+		a, b := pending.Transactions[i], pending.Transactions[j]
+		if !a.TradedOn.Equal(b.TradedOn) {
+			return a.TradedOn.Before(b.TradedOn)
+		}
+		return a.Side == SideBuy && b.Side == SideSell
+	})
+	return pending, nil
+}
+
+// holdingsToRecord turns the holdings in pending into the buys that bring
+// what the user has recorded up to them, leaving out companies already held
+// in full, so importing the same file again adds nothing. It returns how many
+// were left out. Shares recorded beyond the file aren't sold, as the user may
+// hold them with another broker.
+func holdingsToRecord(existing []model.Transaction, pending *model.PendingImport) (int, error) {
+	holdings, _, err := BuildHoldings(existing)
+	if err != nil {
+		return 0, err
+	}
+	held := make(map[string]float64)
+	for _, holding := range holdings {
+		held[cmp.Or(holding.ISIN, holding.Exchange+":"+holding.Symbol)] += holding.Quantity
+	}
+
+	var buys []model.Transaction
+	alreadyHeld := 0
+	for _, t := range pending.Transactions {
+		have := held[companyKey(t)]
+		if t.ISIN != "" {
+			// Trades recorded before the listing had an ISIN are held by listing
+			have += held[listingKey(t)]
+		}
+		if t.Quantity-have <= quantityEpsilon {
+			alreadyHeld++
+			continue
+		}
+		// The same top-up from the same starting point is recorded once
+		t.ExternalID = holdingIDPrefix + companyKey(t) + ":" + formatQuantity(have) + "-" + formatQuantity(t.Quantity)
+		t.Quantity -= have
+		buys = append(buys, t)
+	}
+	pending.Transactions = buys
+	return alreadyHeld, nil
+}
+
+// companyKey is how BuildHoldings groups t: by ISIN, or by listing without one
+func companyKey(t model.Transaction) string {
+	if t.ISIN != "" {
+		return t.ISIN
+	}
+	return listingKey(t)
+}
+
+func listingKey(t model.Transaction) string {
+	return listingExchange(t.Exchange) + ":" + strings.ToUpper(t.Symbol)
+}
+
+func formatQuantity(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// stocksByISIN looks up listings by ISIN, preferring NSE
+func stocksByISIN(ctx context.Context, db *sql.DB, isins []string) (map[string]model.Stock, error) {
+	byISIN := make(map[string]model.Stock)
+	if len(isins) == 0 {
+		return byISIN, nil
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+stockColumns+` FROM stocks
+		WHERE isin = ANY($1)
+		ORDER BY exchange DESC
+	`, pq.Array(isins))
+	if err != nil {
+		return nil, err
+	}
+	stocks, err := scanStocks(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, stock := range stocks {
+		if _, ok := byISIN[stock.ISIN]; !ok {
+			byISIN[stock.ISIN] = stock
+		}
+	}
+	return byISIN, nil
+}
+
+// findListing finds the listing with exactly this symbol or BSE scrip code,
+// on exchange when it is NSE or BSE
+func findListing(ctx context.Context, db *sql.DB, symbol, exchange string) (model.Stock, bool, error) {
+	if exchange != ExchangeNSE && exchange != ExchangeBSE {
+		exchange = ""
+	}
+	stocks, err := searchStocks(ctx, db, symbol, exchange)
+	if err != nil {
+		return model.Stock{}, false, err
+	}
+	for _, stock := range stocks {
+		if strings.EqualFold(stock.Symbol, symbol) || stock.ScripCode == symbol {
+			return stock, true, nil
+		}
+	}
+	return model.Stock{}, false, nil
+}
+
+// SavePendingImport keeps pending until the user confirms or cancels it,
+// replacing any import they hadn't confirmed
+func SavePendingImport(ctx context.Context, db *sql.DB, user *model.User, pending model.PendingImport) error {
+	transactions, err := json.Marshal(pending.Transactions)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO pending_imports (user_id, broker, kind, transactions, skipped, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE
+		SET broker = EXCLUDED.broker, kind = EXCLUDED.kind, transactions = EXCLUDED.transactions,
+		    skipped = EXCLUDED.skipped, created_at = EXCLUDED.created_at
+	`, user.ID, pending.Broker, pending.Kind, transactions, pq.Array(pending.Skipped), pending.CreatedAt)
+	return err
+}
+
+// GetPendingImport returns the user's unexpired pending import, or ErrNoPendingImport
+func GetPendingImport(ctx context.Context, db *sql.DB, user *model.User) (*model.PendingImport, error) {
+	var pending model.PendingImport
+	var transactions []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT broker, kind, transactions, skipped, created_at FROM pending_imports
+		WHERE user_id = $1 AND created_at > $2
+	`, user.ID, time.Now().Add(-pendingImportTTL)).Scan(
+		&pending.Broker, &pending.Kind, &transactions, pq.Array(&pending.Skipped), &pending.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoPendingImport
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(transactions, &pending.Transactions); err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
+
+// DeletePendingImport drops the user's pending import, if any
+func DeletePendingImport(ctx context.Context, db *sql.DB, user *model.User) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM pending_imports WHERE user_id = $1`, user.ID)
+	return err
+}
+
+// ConfirmPendingImport records the transactions of the user's pending import
+// and drops it. It returns the import and how many transactions were new.
+// A rejected import, e.g. one that sells more than is held, is kept so the
+// user can fix their trades and confirm again.
+func ConfirmPendingImport(ctx context.Context, db *sql.DB, user *model.User) (*model.PendingImport, int, error) {
+	pending, err := GetPendingImport(ctx, db, user)
+	if err != nil {
+		return nil, 0, err
+	}
+	recorded, err := RecordTransactions(ctx, db, user, pending.Transactions)
+	if err != nil {
+		return pending, 0, err
+	}
+	return pending, recorded, DeletePendingImport(ctx, db, user)
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"stocks-info-channel/model"
+)
+
+func TestHoldingsToRecord(t *testing.T) {
+	importDay := day(2026, time.October, 19)
+	holding := func(symbol, isin string, quantity, price float64) model.Transaction {
+		return model.Transaction{Symbol: symbol, Exchange: ExchangeNSE, ISIN: isin, Side: SideBuy, Quantity: quantity, Price: price, TradedOn: importDay, Source: "zerodha"}
+	}
+	buy := func(symbol, exchange, isin string, quantity float64) model.Transaction {
+		return model.Transaction{Symbol: symbol, Exchange: exchange, ISIN: isin, Side: SideBuy, Quantity: quantity, Price: 100, TradedOn: day(2024, time.January, 1)}
+	}
+	sell := func(symbol, isin string, quantity float64) model.Transaction {
+		return model.Transaction{Symbol: symbol, Exchange: ExchangeNSE, ISIN: isin, Side: SideSell, Quantity: quantity, Price: 150, TradedOn: day(2025, time.January, 1)}
+	}
+	topUp := func(t model.Transaction, quantity float64, externalID string) model.Transaction {
+		t.Quantity, t.ExternalID = quantity, externalID
+		return t
+	}
+
+	tcs := holding("TCS", "INE467B01029", 10, 3300)
+	infy := holding("INFY", "INE009A01021", 5, 1500)
+	tests := []struct {
+		name            string
+		existing        []model.Transaction
+		snapshot        []model.Transaction
+		want            []model.Transaction
+		wantAlreadyHeld int
+	}{
+		{
+			name:     "nothing recorded yet",
+			snapshot: []model.Transaction{tcs, infy},
+			want: []model.Transaction{
+				topUp(tcs, 10, "holding:INE467B01029:0-10"),
+				topUp(infy, 5, "holding:INE009A01021:0-5"),
+			},
+		},
+		{
+			name:            "the same file again adds nothing",
+			existing:        []model.Transaction{topUp(tcs, 10, "holding:INE467B01029:0-10"), topUp(infy, 5, "holding:INE009A01021:0-5")},
+			snapshot:        []model.Transaction{tcs, infy},
+			wantAlreadyHeld: 2,
+		},
+		{
+			name:            "only the shares not yet recorded are added",
+			existing:        []model.Transaction{buy("TCS", ExchangeBSE, "INE467B01029", 4), buy("INFY", ExchangeNSE, "INE009A01021", 8)},
+			snapshot:        []model.Transaction{tcs, infy},
+			want:            []model.Transaction{topUp(tcs, 6, "holding:INE467B01029:4-10")},
+			wantAlreadyHeld: 1,
+		},
+		{
+			name:     "sold shares are topped up again",
+			existing: []model.Transaction{buy("TCS", ExchangeNSE, "INE467B01029", 10), sell("TCS", "INE467B01029", 7)},
+			snapshot: []model.Transaction{tcs},
+			want:     []model.Transaction{topUp(tcs, 7, "holding:INE467B01029:3-10")},
+		},
+		{
+			name:            "trades recorded without an ISIN count",
+			existing:        []model.Transaction{buy("TCS", ExchangeNSE, "", 10)},
+			snapshot:        []model.Transaction{tcs},
+			wantAlreadyHeld: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending := model.PendingImport{Kind: ImportHoldings, Transactions: tt.snapshot}
+			alreadyHeld, err := holdingsToRecord(tt.existing, &pending)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pending.Transactions, tt.want) {
+				t.Errorf("transactions:\n got %+v\nwant %+v", pending.Transactions, tt.want)
+			}
+			if alreadyHeld != tt.wantAlreadyHeld {
+				t.Errorf("already held = %d, want %d", alreadyHeld, tt.wantAlreadyHeld)
+			}
+		})
+	}
+}
+
+func TestHoldingsImportDateUnknown(t *testing.T) {
+	transactions := []model.Transaction{
+		{Symbol: "TCS", Exchange: ExchangeNSE, Side: SideBuy, Quantity: 5, Price: 100, TradedOn: day(2024, time.January, 1)},
+		{Symbol: "TCS", Exchange: ExchangeNSE, Side: SideBuy, Quantity: 5, Price: 200, TradedOn: day(2024, time.June, 1), Source: "zerodha", ExternalID: "holding:NSE:TCS:5-10"},
+		{Symbol: "TCS", Exchange: ExchangeNSE, Side: SideSell, Quantity: 10, Price: 300, TradedOn: day(2024, time.September, 1)},
+	}
+	_, disposals, err := BuildHoldings(transactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disposals) != 2 || disposals[0].DateUnknown || !disposals[1].DateUnknown {
+		t.Fatalf("disposals = %+v, want only the imported lot's date unknown", disposals)
+	}
+	if report := capitalGainsReport(2024, disposals, nil); !report.DateUnknown {
+		t.Error("report doesn't flag the unknown purchase date")
+	}
+}
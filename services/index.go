@@ -0,0 +1,84 @@
+package services
+
+import (
+	"slices"
+	"strings"
+
+	"stocks-info-channel/model"
+)
+
+// ExchangeIndex marks an index instrument rather than a listed stock
+const ExchangeIndex = "INDEX"
+
+// Index is a market index we can quote. Symbol is our own name for it, used
+// in commands and choice payloads; Ticker is what quote providers call it.
+type Index struct {
+	Symbol  string
+	Name    string
+	Ticker  string
+	Aliases []string // other spellings users type, compared without spaces
+	Sector  string   // bare word such as "bank", only understood by the index command
+}
+
+// indices is the catalogue of supported indices
+var indices = []Index{
+	{Symbol: "NIFTY50", Name: "NIFTY 50", Ticker: "^NSEI", Aliases: []string{"nifty"}},
+	{Symbol: "SENSEX", Name: "S&P BSE SENSEX", Ticker: "^BSESN", Aliases: []string{"bsesensex"}},
+	{Symbol: "NIFTYBANK", Name: "NIFTY BANK", Ticker: "^NSEBANK", Aliases: []string{"banknifty"}, Sector: "bank"},
+	{Symbol: "NIFTYNEXT50", Name: "NIFTY NEXT 50", Ticker: "^NSMIDCP", Aliases: []string{"next50", "niftyjunior"}},
+	{Symbol: "NIFTYIT", Name: "NIFTY IT", Ticker: "^CNXIT", Sector: "it"},
+	{Symbol: "NIFTYAUTO", Name: "NIFTY AUTO", Ticker: "^CNXAUTO", Sector: "auto"},
+	{Symbol: "NIFTYPHARMA", Name: "NIFTY PHARMA", Ticker: "^CNXPHARMA", Sector: "pharma"},
+	{Symbol: "NIFTYFMCG", Name: "NIFTY FMCG", Ticker: "^CNXFMCG", Sector: "fmcg"},
+	{Symbol: "NIFTYMETAL", Name: "NIFTY METAL", Ticker: "^CNXMETAL", Sector: "metal"},
+	{Symbol: "NIFTYREALTY", Name: "NIFTY REALTY", Ticker: "^CNXREALTY", Sector: "realty"},
+	{Symbol: "NIFTYENERGY", Name: "NIFTY ENERGY", Ticker: "^CNXENERGY", Sector: "energy"},
+	{Symbol: "NIFTYMEDIA", Name: "NIFTY MEDIA", Ticker: "^CNXMEDIA", Sector: "media"},
+	{Symbol: "NIFTYPSUBANK", Name: "NIFTY PSU BANK", Ticker: "^CNXPSUBANK", Sector: "psubank"},
+	{Symbol: "NIFTYFINSERVICE", Name: "NIFTY FINANCIAL SERVICES", Ticker: "NIFTY_FIN_SERVICE.NS", Aliases: []string{"finnifty", "niftyfin"}, Sector: "finance"},
+	{Symbol: "INDIAVIX", Name: "INDIA VIX", Ticker: "^INDIAVIX", Aliases: []string{"vix"}},
+}
+
+// Stock returns the index as an instrument that can be quoted like a listing
+func (i Index) Stock() model.Stock {
+	return model.Stock{Symbol: i.Symbol, CompanyName: i.Name, Exchange: ExchangeIndex}
+}
+
+// Indices returns the catalogue of supported indices
+func Indices() []Index {
+	return indices
+}
+
+// FindIndex matches query against index symbols, names and aliases, ignoring
+// case and spaces, so "nifty bank", "banknifty" and "NIFTYBANK" all match.
+// Sector words like "bank" would shadow stock searches, so they are only
+// matched when sectors is set.
+func FindIndex(query string, sectors bool) (Index, bool) {
+	key := indexKey(query)
+	if key == "" {
+		return Index{}, false
+	}
+	for _, index := range indices {
+		if key == indexKey(index.Symbol) || key == indexKey(index.Name) ||
+			slices.Contains(index.Aliases, key) || (sectors && key == index.Sector) {
+			return index, true
+		}
+	}
+	return Index{}, false
+}
+
+// indexTicker is the provider ticker of the index with symbol
+func indexTicker(symbol string) string {
+	for _, index := range indices {
+		if index.Symbol == symbol {
+			return index.Ticker
+		}
+	}
+	return symbol
+}
+
+func indexKey(s string) string {
+	s = strings.ToLower(s)
+	s = strings.ReplaceAll(s, " ", "")
+	return strings.TrimPrefix(s, "s&p")
+}
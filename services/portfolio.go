@@ -0,0 +1,325 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"stocks-info-channel/logging"
+	"stocks-info-channel/market"
+	"stocks-info-channel/model"
+)
+
+// Transaction sides
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
+// SourceWhatsApp marks transactions the user typed rather than imported
+const SourceWhatsApp = "whatsapp"
+
+// ErrInvalidTrade is returned for a trade message that can't be understood
+var ErrInvalidTrade = errors.New("invalid trade")
+
+// OversoldError is returned when a sale is for more shares than were held on its date
+type OversoldError struct {
+	Symbol  string
+	Held    float64
+	Selling float64
+}
+
+func (e *OversoldError) Error() string {
+	return fmt.Sprintf("selling %g %s with only %g held", e.Selling, e.Symbol, e.Held)
+}
+
+// quantityEpsilon absorbs float rounding when lots are split
+const quantityEpsilon = 1e-9
+
+// tradePattern matches "tcs 10 @ 3500 on 12-03-2024"; the "@" may be "at",
+// the price may carry a ₹ and commas, and the date is optional
+var tradePattern = regexp.MustCompile(`^(.+?)\s+(\d+(?:\.\d+)?)\s*(?:@|at)\s*(?:₹|rs\.?)?\s*([\d,]+(?:\.\d+)?)(?:\s+(?:on\s+)?(\d{1,2}[-/.]\d{1,2}[-/.]\d{4}))?$`)
+
+// TradeQuery is a buy or sell as typed by the user, before the stock is looked up
+type TradeQuery struct {
+	Stock    StockQuery
+	Quantity float64
+	Price    float64
+	TradedOn time.Time
+}
+
+// ParseTrade reads what follows "buy" or "sell". Dates are day first, as in
+// India; trades without one happened today in IST. Future dates are rejected.
+func ParseTrade(query string, now time.Time) (TradeQuery, error) {
+	m := tradePattern.FindStringSubmatch(strings.TrimSpace(query))
+	if m == nil {
+		return TradeQuery{}, ErrInvalidTrade
+	}
+
+	quantity, err := strconv.ParseFloat(m[2], 64)
+	if err != nil || quantity <= 0 {
+		return TradeQuery{}, ErrInvalidTrade
+	}
+	price, err := strconv.ParseFloat(strings.ReplaceAll(m[3], ",", ""), 64)
+	if err != nil || price <= 0 {
+		return TradeQuery{}, ErrInvalidTrade
+	}
+
+	today := market.In(now)
+	tradedOn := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	if m[4] != "" {
+		date := strings.NewReplacer("/", "-", ".", "-").Replace(m[4])
+		if tradedOn, err = time.Parse("2-1-2006", date); err != nil {
+			return TradeQuery{}, ErrInvalidTrade
+		}
+		if tradedOn.After(time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)) {
+			return TradeQuery{}, ErrInvalidTrade
+		}
+	}
+
+	return TradeQuery{
+		Stock:    ParseStockQuery(m[1]),
+		Quantity: quantity,
+		Price:    price,
+		TradedOn: tradedOn,
+	}, nil
+}
+
+const transactionColumns = `id, user_id, symbol, exchange, isin, side, quantity, price, traded_on,
+	source, external_id, created_at`
+
+// ListTransactions returns the user's transactions in the order they were traded
+func ListTransactions(ctx context.Context, db *sql.DB, user *model.User) ([]model.Transaction, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+transactionColumns+` FROM transactions
+		WHERE user_id = $1
+		ORDER BY traded_on, id
+	`, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanTransactions(rows)
+}
+
+func scanTransactions(rows *sql.Rows) ([]model.Transaction, error) {
+	var transactions []model.Transaction
+	for rows.Next() {
+		var t model.Transaction
+		err := rows.Scan(&t.ID, &t.UserID, &t.Symbol, &t.Exchange, &t.ISIN, &t.Side,
+			&t.Quantity, &t.Price, &t.TradedOn, &t.Source, &t.ExternalID, &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// RecordTransactions stores new transactions for the user and returns how many
+// were stored. Imported transactions already recorded under the same source
+// and external id are skipped. It fails with an OversoldError, storing none,
+// if any sale would take a holding below zero.
+func RecordTransactions(ctx context.Context, db *sql.DB, user *model.User, transactions []model.Transaction) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Serialise a user's trades so two sales can't both pass the check below
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, user.ID); err != nil {
+		return 0, err
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+transactionColumns+` FROM transactions
+		WHERE user_id = $1
+		ORDER BY traded_on, id
+	`, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	existing, err := scanTransactions(rows)
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	seen := make(map[string]bool)
+	for _, t := range existing {
+		if t.ExternalID != "" {
+			seen[t.Source+":"+t.ExternalID] = true
+		}
+	}
+	var fresh []model.Transaction
+	for _, t := range transactions {
+		t.Source = cmp.Or(t.Source, SourceWhatsApp)
+		if t.ExternalID != "" {
+			if seen[t.Source+":"+t.ExternalID] {
+				continue
+			}
+			seen[t.Source+":"+t.ExternalID] = true
+		}
+		fresh = append(fresh, t)
+	}
+	if _, _, err := BuildHoldings(append(existing, fresh...)); err != nil {
+		return 0, err
+	}
+
+	for _, t := range fresh {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO transactions (user_id, symbol, exchange, isin, side, quantity, price, traded_on, source, external_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`, user.ID, t.Symbol, listingExchange(t.Exchange), t.ISIN, t.Side, t.Quantity, t.Price, t.TradedOn, t.Source, t.ExternalID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(fresh), nil
+}
+
+// BuildHoldings replays transactions, matching each sale against the oldest
+// open lots of the same company. Shares are the same on NSE and BSE, so lots
+// are kept per ISIN and only per listing when the ISIN is unknown. It returns
+// holdings, including fully sold ones that only have realised P&L, and every
+// lot each sale consumed.
+func BuildHoldings(transactions []model.Transaction) ([]*model.Holding, []model.Disposal, error) {
+	// Stable, so trades on the same day keep the order they were recorded in
+	sorted := make([]model.Transaction, len(transactions))
+	copy(sorted, transactions)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].TradedOn.Before(sorted[j].TradedOn) })
+
+	// A trade recorded without an ISIN joins the company of any other trade
+	// of its listing that has one
+	isinOf := make(map[string]string)
+	for _, t := range sorted {
+		if t.ISIN != "" {
+			isinOf[listingExchange(t.Exchange)+":"+strings.ToUpper(t.Symbol)] = t.ISIN
+		}
+	}
+
+	byListing := make(map[string]*model.Holding)
+	var disposals []model.Disposal
+	for _, t := range sorted {
+		exchange := listingExchange(t.Exchange)
+		key := exchange + ":" + strings.ToUpper(t.Symbol)
+		isin := cmp.Or(t.ISIN, isinOf[key])
+		if isin != "" {
+			key = isin
+		}
+		holding, ok := byListing[key]
+		if !ok {
+			holding = &model.Holding{Symbol: strings.ToUpper(t.Symbol), Exchange: exchange, ISIN: isin}
+			byListing[key] = holding
+		}
+
+		switch t.Side {
+		case SideBuy:
+			holding.Lots = append(holding.Lots, model.Lot{
+				Quantity:    t.Quantity,
+				Price:       t.Price,
+				BoughtOn:    t.TradedOn,
+				DateUnknown: strings.HasPrefix(t.ExternalID, holdingIDPrefix),
+			})
+			holding.Quantity += t.Quantity
+		case SideSell:
+			if t.Quantity > holding.Quantity+quantityEpsilon {
+				return nil, nil, &OversoldError{Symbol: holding.Symbol, Held: holding.Quantity, Selling: t.Quantity}
+			}
+			remaining := t.Quantity
+			for remaining > quantityEpsilon {
+				lot := &holding.Lots[0]
+				sold := math.Min(lot.Quantity, remaining)
+				// The sale's own listing, which may differ from the one bought on
+				disposals = append(disposals, model.Disposal{
+					Symbol:      strings.ToUpper(t.Symbol),
+					Exchange:    exchange,
+					ISIN:        holding.ISIN,
+					Quantity:    sold,
+					BuyPrice:    lot.Price,
+					BoughtOn:    lot.BoughtOn,
+					SellPrice:   t.Price,
+					SoldOn:      t.TradedOn,
+					DateUnknown: lot.DateUnknown,
+				})
+				holding.Realised += sold * (t.Price - lot.Price)
+				lot.Quantity -= sold
+				remaining -= sold
+				if lot.Quantity <= quantityEpsilon {
+					holding.Lots = holding.Lots[1:]
+				}
+			}
+			holding.Quantity -= t.Quantity
+			if holding.Quantity <= quantityEpsilon {
+				holding.Quantity = 0
+			}
+		default:
+			return nil, nil, fmt.Errorf("transaction %d: unknown side %q", t.ID, t.Side)
+		}
+	}
+
+	holdings := make([]*model.Holding, 0, len(byListing))
+	for _, holding := range byListing {
+		holding.Invested = 0
+		for _, lot := range holding.Lots {
+			holding.Invested += lot.Quantity * lot.Price
+		}
+		if holding.Quantity > quantityEpsilon {
+			holding.AverageCost = holding.Invested / holding.Quantity
+		}
+		holdings = append(holdings, holding)
+	}
+	sort.Slice(holdings, func(i, j int) bool { return holdings[i].Symbol < holdings[j].Symbol })
+	return holdings, disposals, nil
+}
+
+// ValuePortfolio prices the open holdings concurrently and totals the portfolio
+func ValuePortfolio(ctx context.Context, chain *QuoteChain, holdings []*model.Holding) model.Portfolio {
+	var wg sync.WaitGroup
+	for _, holding := range holdings {
+		if holding.Quantity <= quantityEpsilon {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			perf, err := GetStockPerformance(ctx, chain, model.Stock{Symbol: holding.Symbol, Exchange: holding.Exchange})
+			if err != nil {
+				logging.FromContext(ctx).Warn("failed to price holding", "symbol", holding.Symbol, "error", err)
+				return
+			}
+			holding.Current = perf.Current
+			holding.Value = holding.Quantity * perf.Current
+			holding.Unrealised = holding.Value - holding.Invested
+		}()
+	}
+	wg.Wait()
+
+	portfolio := model.Portfolio{Holdings: holdings}
+	for _, holding := range holdings {
+		portfolio.Invested += holding.Invested
+		portfolio.Realised += holding.Realised
+		if holding.Quantity <= quantityEpsilon {
+			continue
+		}
+		if holding.Current == 0 {
+			portfolio.Unpriced = true
+			continue
+		}
+		portfolio.Value += holding.Value
+		portfolio.Unrealised += holding.Unrealised
+	}
+	return portfolio
+}
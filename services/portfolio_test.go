@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"stocks-info-channel/model"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseTrade(t *testing.T) {
+	// 19 Oct 2026 in IST
+	now := time.Date(2026, time.October, 19, 6, 0, 0, 0, time.UTC)
+	today := day(2026, time.October, 19)
+
+	tests := []struct {
+		query   string
+		want    TradeQuery
+		wantErr bool
+	}{
+		{
+			query: "tcs 10 @ 3500",
+			want:  TradeQuery{Stock: StockQuery{Text: "tcs"}, Quantity: 10, Price: 3500, TradedOn: today},
+		},
+		{
+			query: "tcs 10 at ₹3,500.50 on 12-03-2024",
+			want:  TradeQuery{Stock: StockQuery{Text: "tcs"}, Quantity: 10, Price: 3500.5, TradedOn: day(2024, time.March, 12)},
+		},
+		{
+			query: "reliance bse 2.5 @ rs 2450 1/4/2024",
+			want:  TradeQuery{Stock: StockQuery{Text: "reliance", Exchange: ExchangeBSE}, Quantity: 2.5, Price: 2450, TradedOn: day(2024, time.April, 1)},
+		},
+		{query: "tcs 10 @ 0", wantErr: true},
+		{query: "tcs 0 @ 3500", wantErr: true},
+		{query: "tcs 10 @ 3500 on 20-10-2026", wantErr: true},
+		{query: "tcs 10 @ 3500 on 31-02-2024", wantErr: true},
+		{query: "tcs ten @ 3500", wantErr: true},
+		{query: "tcs", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := ParseTrade(tt.query, now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTrade) {
+					t.Fatalf("ParseTrade(%q) error = %v, want ErrInvalidTrade", tt.query, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTrade(%q): %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTrade(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildHoldingsFIFO(t *testing.T) {
+	trade := func(symbol, exchange, isin, side string, quantity, price float64, on time.Time) model.Transaction {
+		return model.Transaction{Symbol: symbol, Exchange: exchange, ISIN: isin, Side: side, Quantity: quantity, Price: price, TradedOn: on}
+	}
+
+	tests := []struct {
+		name          string
+		transactions  []model.Transaction
+		wantDisposals []model.Disposal
+		wantQuantity  float64 // still held
+		wantRealised  float64
+		wantOversold  bool
+	}{
+		{
+			name: "a sale consumes the oldest lots first",
+			transactions: []model.Transaction{
+				trade("TCS", "NSE", "", SideBuy, 10, 100, day(2024, time.January, 1)),
+				trade("TCS", "NSE", "", SideBuy, 10, 200, day(2024, time.February, 1)),
+				trade("TCS", "NSE", "", SideSell, 15, 300, day(2024, time.March, 1)),
+			},
+			wantDisposals: []model.Disposal{
+				{Symbol: "TCS", Exchange: "NSE", Quantity: 10, BuyPrice: 100, BoughtOn: day(2024, time.January, 1), SellPrice: 300, SoldOn: day(2024, time.March, 1)},
+				{Symbol: "TCS", Exchange: "NSE", Quantity: 5, BuyPrice: 200, BoughtOn: day(2024, time.February, 1), SellPrice: 300, SoldOn: day(2024, time.March, 1)},
+			},
+			wantQuantity: 5,
+			wantRealised: 10*200 + 5*100,
+		},
+		{
+			name: "trades are replayed in date order",
+			transactions: []model.Transaction{
+				trade("TCS", "NSE", "", SideSell, 5, 300, day(2024, time.March, 1)),
+				trade("TCS", "NSE", "", SideBuy, 5, 100, day(2024, time.January, 1)),
+			},
+			wantDisposals: []model.Disposal{
+				{Symbol: "TCS", Exchange: "NSE", Quantity: 5, BuyPrice: 100, BoughtOn: day(2024, time.January, 1), SellPrice: 300, SoldOn: day(2024, time.March, 1)},
+			},
+			wantRealised: 5 * 200,
+		},
+		{
+			name: "a sale on NSE consumes lots bought on BSE",
+			transactions: []model.Transaction{
+				trade("TCS", "BSE", "INE467B01029", SideBuy, 10, 100, day(2024, time.January, 1)),
+				trade("TCS", "NSE", "INE467B01029", SideSell, 4, 150, day(2024, time.March, 1)),
+			},
+			wantDisposals: []model.Disposal{
+				{Symbol: "TCS", Exchange: "NSE", ISIN: "INE467B01029", Quantity: 4, BuyPrice: 100, BoughtOn: day(2024, time.January, 1), SellPrice: 150, SoldOn: day(2024, time.March, 1)},
+			},
+			wantQuantity: 6,
+			wantRealised: 4 * 50,
+		},
+		{
+			name: "a trade without an ISIN joins its listing's company",
+			transactions: []model.Transaction{
+				trade("TCS", "BSE", "", SideBuy, 10, 100, day(2024, time.January, 1)),
+				trade("TCS", "BSE", "INE467B01029", SideBuy, 10, 120, day(2024, time.January, 2)),
+				trade("TCS", "NSE", "INE467B01029", SideSell, 20, 150, day(2024, time.March, 1)),
+			},
+			wantDisposals: []model.Disposal{
+				{Symbol: "TCS", Exchange: "NSE", ISIN: "INE467B01029", Quantity: 10, BuyPrice: 100, BoughtOn: day(2024, time.January, 1), SellPrice: 150, SoldOn: day(2024, time.March, 1)},
+				{Symbol: "TCS", Exchange: "NSE", ISIN: "INE467B01029", Quantity: 10, BuyPrice: 120, BoughtOn: day(2024, time.January, 2), SellPrice: 150, SoldOn: day(2024, time.March, 1)},
+			},
+			wantRealised: 10*50 + 10*30,
+		},
+		{
+			name: "selling more than is held is rejected",
+			transactions: []model.Transaction{
+				trade("TCS", "NSE", "", SideBuy, 5, 100, day(2024, time.January, 1)),
+				trade("TCS", "NSE", "", SideSell, 6, 150, day(2024, time.March, 1)),
+			},
+			wantOversold: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holdings, disposals, err := BuildHoldings(tt.transactions)
+			if tt.wantOversold {
+				var oversold *OversoldError
+				if !errors.As(err, &oversold) {
+					t.Fatalf("error = %v, want an OversoldError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildHoldings: %v", err)
+			}
+			if !reflect.DeepEqual(disposals, tt.wantDisposals) {
+				t.Errorf("disposals:\n got %+v\nwant %+v", disposals, tt.wantDisposals)
+			}
+			if len(holdings) != 1 {
+				t.Fatalf("got %d holdings, want 1", len(holdings))
+			}
+			if holdings[0].Quantity != tt.wantQuantity || holdings[0].Realised != tt.wantRealised {
+				t.Errorf("holding quantity %v, realised %v; want %v, %v",
+					holdings[0].Quantity, holdings[0].Realised, tt.wantQuantity, tt.wantRealised)
+			}
+		})
+	}
+}
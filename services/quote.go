@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"stocks-info-channel/config"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/metrics"
+	"stocks-info-channel/model"
+	"stocks-info-channel/upstream"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrNoHealthyProvider is returned when every quote provider is failing
+	ErrNoHealthyProvider = errors.New("no healthy quote provider")
+	// ErrQuoteRateLimited is returned when the global quote budget is spent
+	ErrQuoteRateLimited = errors.New("quote rate limit exceeded")
+)
+
+// QuoteProvider is one backend that serves quotes at URL + ticker
+type QuoteProvider struct {
+	name     string
+	url      string
+	suffixes map[string]string // ticker suffix by exchange
+	client   *upstream.Client
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+}
+
+// ProviderHealth is a snapshot of how a provider has been doing
+type ProviderHealth struct {
+	Name        string    `json:"name"`
+	Healthy     bool      `json:"healthy"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	LastError   string    `json:"last_error,omitempty"` // a category such as "timeout", never the raw error
+}
+
+// QuoteChain asks providers in order and returns the first answer. Providers
+// whose circuit breaker is open are skipped until they recover.
+type QuoteChain struct {
+	providers []*QuoteProvider
+	cacheTTL  time.Duration
+	limiter   *rate.Limiter // global budget for upstream calls
+}
+
+// NewQuoteChain builds the provider chain from cfg. Each provider gets its own
+// upstream client so one failing backend doesn't trip the others' breakers.
+func NewQuoteChain(cfg *config.Config) *QuoteChain {
+	options := upstream.Options{
+		Timeout:          cfg.UpstreamTimeout,
+		MaxRetries:       cfg.UpstreamMaxRetries,
+		RetryBaseDelay:   cfg.UpstreamRetryBaseDelay,
+		FailureThreshold: cfg.BreakerFailureThreshold,
+		Cooldown:         cfg.BreakerCooldown,
+	}
+
+	chain := &QuoteChain{
+		cacheTTL: cfg.QuoteCacheTTL,
+		limiter:  newLimiter(cfg.QuoteLimit()),
+	}
+	for _, p := range cfg.Providers() {
+		chain.providers = append(chain.providers, &QuoteProvider{
+			name:     p.Name,
+			url:      p.URL,
+			suffixes: p.Suffixes,
+			client:   upstream.NewClient(p.Name, options),
+		})
+	}
+	return chain
+}
+
+// Quote returns the quote for symbol on exchange and the name of the provider that served it
+func (q *QuoteChain) Quote(ctx context.Context, symbol, exchange string) (model.StockAPIResponse, string, error) {
+	logger := logging.FromContext(ctx)
+
+	// Wait for budget, but only as long as the request deadline allows
+	if err := q.limiter.Wait(ctx); err != nil {
+		metrics.RateLimited.WithLabelValues("quote").Inc()
+		return model.StockAPIResponse{}, "", fmt.Errorf("%w: %w", ErrQuoteRateLimited, err)
+	}
+
+	var errs []error
+	for i, provider := range q.providers {
+		if !provider.client.Healthy() {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.name, upstream.ErrCircuitOpen))
+			continue
+		}
+
+		apiResp, err := provider.fetch(ctx, provider.ticker(symbol, exchange))
+		if err == nil {
+			if i > 0 {
+				logger.Warn("quote served by fallback provider", "provider", provider.name, "symbol", symbol)
+			}
+			metrics.QuotesServed.WithLabelValues(provider.name).Inc()
+			return apiResp, provider.name, nil
+		}
+		if ctx.Err() != nil {
+			return model.StockAPIResponse{}, "", err
+		}
+		// A half-open breaker already trying a call turns us away just like
+		// an open one; that is no failure of the provider
+		if errors.Is(err, upstream.ErrCircuitOpen) {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.name, err))
+			continue
+		}
+
+		logger.Warn("quote provider failed, trying next", "provider", provider.name, "symbol", symbol, "error", err)
+		metrics.QuoteFailovers.WithLabelValues(provider.name).Inc()
+		errs = append(errs, err)
+	}
+
+	return model.StockAPIResponse{}, "", fmt.Errorf("%w: %w", ErrNoHealthyProvider, errors.Join(errs...))
+}
+
+// Health reports every provider's state, in chain order
+func (q *QuoteChain) Health() []ProviderHealth {
+	health := make([]ProviderHealth, 0, len(q.providers))
+	for _, provider := range q.providers {
+		provider.mu.Lock()
+		health = append(health, ProviderHealth{
+			Name:        provider.name,
+			Healthy:     provider.client.Healthy(),
+			LastSuccess: provider.lastSuccess,
+			LastFailure: provider.lastFailure,
+			LastError:   provider.lastError,
+		})
+		provider.mu.Unlock()
+	}
+	return health
+}
+
+// errorCategory describes a fetch failure without its URL, which carries the
+// symbol and possibly the provider's API key
+func errorCategory(err error) string {
+	var statusErr *upstream.StatusError
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("status %d", statusErr.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return "invalid response"
+	case errors.As(err, &netErr):
+		return "connection failed"
+	default:
+		return "error"
+	}
+}
+
+// ticker is how this provider names symbol on exchange, e.g. RELIANCE.BO or ^NSEI
+func (p *QuoteProvider) ticker(symbol, exchange string) string {
+	if strings.EqualFold(exchange, ExchangeIndex) {
+		return indexTicker(symbol)
+	}
+	return symbol + p.suffixes[strings.ToUpper(exchange)]
+}
+
+// fetch calls the provider and records its latency, errors and health,
+// unless the circuit breaker refused the call
+func (p *QuoteProvider) fetch(ctx context.Context, ticker string) (model.StockAPIResponse, error) {
+	start := time.Now()
+	var apiResp model.StockAPIResponse
+	err := p.client.GetJSON(ctx, p.url+url.QueryEscape(ticker), &apiResp)
+	if errors.Is(err, upstream.ErrCircuitOpen) {
+		// The breaker refused the call, so there is nothing to record
+		return apiResp, err
+	}
+	metrics.QuoteProviderDuration.WithLabelValues(p.name).Observe(time.Since(start).Seconds())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		metrics.QuoteProviderErrors.WithLabelValues(p.name).Inc()
+		p.lastFailure = time.Now()
+		p.lastError = errorCategory(err)
+		return apiResp, err
+	}
+	p.lastSuccess = time.Now()
+	return apiResp, nil
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"stocks-info-channel/upstream"
+)
+
+func TestErrorCategory(t *testing.T) {
+	const quoteURL = "https://example.com/price?symbol=TCS.NS&apikey=secret"
+	dnsErr := &net.DNSError{Err: "no such host", Name: "example.com"}
+	timeoutErr := &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&upstream.StatusError{StatusCode: 503}, "status 503"},
+		{fmt.Errorf("primary: %w", &upstream.StatusError{StatusCode: 404}), "status 404"},
+		{&url.Error{Op: "Get", URL: quoteURL, Err: context.DeadlineExceeded}, "timeout"},
+		{&url.Error{Op: "Get", URL: quoteURL, Err: timeoutErr}, "timeout"},
+		{&url.Error{Op: "Get", URL: quoteURL, Err: context.Canceled}, "cancelled"},
+		{&url.Error{Op: "Get", URL: quoteURL, Err: dnsErr}, "connection failed"},
+		{json.Unmarshal([]byte("<html>"), &struct{}{}), "invalid response"},
+		{errors.New("something else"), "error"},
+	}
+	for _, tt := range tests {
+		if got := errorCategory(tt.err); got != tt.want {
+			t.Errorf("errorCategory(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
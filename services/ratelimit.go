@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"stocks-info-channel/config"
+	"stocks-info-channel/metrics"
+
+	"golang.org/x/time/rate"
+)
+
+// UserLimiter is a token bucket per phone number, sized by the user's tier
+type UserLimiter struct {
+	cfg *config.Config
+
+	mu      sync.Mutex
+	buckets map[string]*userBucket
+}
+
+type userBucket struct {
+	limiter  *rate.Limiter
+	tier     string
+	notified bool // already told to slow down during this throttled spell
+	lastSeen time.Time
+}
+
+// NewUserLimiter returns an empty limiter using the tier limits in cfg
+func NewUserLimiter(cfg *config.Config) *UserLimiter {
+	return &UserLimiter{cfg: cfg, buckets: make(map[string]*userBucket)}
+}
+
+// Allow takes a token for phone. When the user is over their limit it returns
+// allowed=false with how long until the next token, and notify=true only the
+// first time, so they get a single "slow down" reply and then silence until
+// their budget refills.
+func (l *UserLimiter) Allow(phone, tier string) (allowed, notify bool, wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[phone]
+	if !ok || bucket.tier != tier {
+		bucket = &userBucket{limiter: newLimiter(l.cfg.UserRateLimit(tier)), tier: tier}
+		l.buckets[phone] = bucket
+	}
+	now := time.Now()
+	bucket.lastSeen = now
+
+	if bucket.limiter.AllowN(now, 1) {
+		bucket.notified = false
+		return true, false, 0
+	}
+
+	// Reserving and cancelling at once tells us the wait without spending a token
+	reservation := bucket.limiter.ReserveN(now, 1)
+	wait = reservation.DelayFrom(now)
+	reservation.CancelAt(now)
+
+	metrics.RateLimited.WithLabelValues("user").Inc()
+	notify = !bucket.notified
+	bucket.notified = true
+	return false, notify, wait
+}
+
+// RunJanitor forgets users idle for longer than idle, checking every interval until ctx is done
+func (l *UserLimiter) RunJanitor(ctx context.Context, interval, idle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for phone, bucket := range l.buckets {
+				if now.Sub(bucket.lastSeen) > idle {
+					delete(l.buckets, phone)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// newLimiter refills limit.Burst tokens evenly over limit.Per
+func newLimiter(limit config.RateLimit) *rate.Limiter {
+	every := limit.Per / time.Duration(limit.Burst)
+	return rate.NewLimiter(rate.Every(every), limit.Burst)
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"stocks-info-channel/config"
+)
+
+func TestUserLimiter(t *testing.T) {
+	limiter := NewUserLimiter(&config.Config{UserRateLimits: map[string]string{
+		"free":    "2/1h",
+		"premium": "4/1h",
+	}})
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := limiter.Allow("+919876543210", "free"); !allowed {
+			t.Fatalf("message %d was throttled, want it within the burst", i+1)
+		}
+	}
+
+	allowed, notify, wait := limiter.Allow("+919876543210", "free")
+	if allowed || !notify {
+		t.Fatalf("third message: allowed %v, notify %v; want throttled and notified", allowed, notify)
+	}
+	// 2 per hour refills a token every 30 minutes
+	if wait < 29*time.Minute || wait > 30*time.Minute {
+		t.Errorf("wait = %v, want about 30m", wait)
+	}
+
+	if allowed, notify, _ := limiter.Allow("+919876543210", "free"); allowed || notify {
+		t.Errorf("fourth message: allowed %v, notify %v; want throttled silently", allowed, notify)
+	}
+	if allowed, _, _ := limiter.Allow("+919812345678", "free"); !allowed {
+		t.Errorf("another user was throttled")
+	}
+	if allowed, _, _ := limiter.Allow("+919876543210", "premium"); !allowed {
+		t.Errorf("an upgraded user kept their old bucket")
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"stocks-info-channel/config"
+	"stocks-info-channel/model"
+)
+
+// TaxReportPath is where capital gains CSVs are served, followed by the user
+// ID and the financial year
+const TaxReportPath = "/reports/tax/"
+
+// TaxReportURL links to the capital gains CSV of user for the financial year
+// starting in fy. The link is signed and stops working after the configured
+// TTL. ok is false when no public URL or signing key is configured.
+func TaxReportURL(cfg *config.Config, user *model.User, fy int, now time.Time) (link string, ok bool) {
+	if cfg.PublicBaseURL == "" || cfg.ReportSigningKey == "" {
+		return "", false
+	}
+	expires := now.Add(cfg.ReportLinkTTL).Unix()
+	query := url.Values{
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {taxReportSignature(cfg.ReportSigningKey, user.ID, fy, expires)},
+	}
+	return strings.TrimSuffix(cfg.PublicBaseURL, "/") + TaxReportPath + user.ID + "/" + strconv.Itoa(fy) + "?" + query.Encode(), true
+}
+
+// VerifyTaxReportLink reports whether signature was made by TaxReportURL for
+// userID and fy and the link hasn't expired
+func VerifyTaxReportLink(cfg *config.Config, userID string, fy int, expires int64, signature string, now time.Time) bool {
+	if cfg.ReportSigningKey == "" || now.Unix() > expires {
+		return false
+	}
+	want := taxReportSignature(cfg.ReportSigningKey, userID, fy, expires)
+	return hmac.Equal([]byte(signature), []byte(want))
+}
+
+func taxReportSignature(key, userID string, fy int, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "tax:%s:%d:%d", userID, fy, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
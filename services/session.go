@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"stocks-info-channel/config"
+	"stocks-info-channel/helper"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/model"
+
+	openApi "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// ErrSessionWindowClosed is returned when a free-form message can't be delivered
+// because the user hasn't written to us recently and no template was supplied
+var ErrSessionWindowClosed = errors.New("whatsapp session window is closed and no template was provided")
+
+// IsSessionWindowOpen reports whether the user messaged us within the WhatsApp
+// customer service window, during which free-form messages are allowed
+func IsSessionWindowOpen(user *model.User, now time.Time) bool {
+	if !user.LastMessageTime.Valid {
+		return false
+	}
+	return now.Sub(user.LastMessageTime.Time) < helper.AppConstant().SessionWindow
+}
+
+// SendProactiveWhatsApp sends a message we initiate (alerts, digests, broadcasts).
+// Inside the session window body is sent as is; outside it the pre-approved
+// template is used instead, since WhatsApp rejects free-form messages there.
+func SendProactiveWhatsApp(ctx context.Context, cfg *config.Config, user *model.User, body string, template model.TemplateMessage) (*openApi.ApiV2010Message, error) {
+	logger := logging.FromContext(ctx).With("user_id", user.ID)
+
+	if IsSessionWindowOpen(user, time.Now()) {
+		logger.Info("session window open, sending free-form message")
+		return SendWhatsApp(ctx, cfg, user.PhoneNumber, body)
+	}
+
+	if template.ContentSid == "" {
+		logger.Warn("session window closed and no template given, not sending")
+		return nil, ErrSessionWindowClosed
+	}
+
+	logger.Info("session window closed, sending template", "content_sid", template.ContentSid)
+	return SendWhatsAppContent(ctx, cfg, user.PhoneNumber, template.ContentSid, template.Variables)
+}
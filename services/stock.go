@@ -1,202 +1,418 @@
 package services
 
 import (
+	"cmp"
+	"context"
 	"database/sql"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"os"
+	"errors"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
 	"stocks-info-channel/helper"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/market"
+	"stocks-info-channel/metrics"
 	"stocks-info-channel/model"
+
+	"github.com/lib/pq"
+)
+
+// Exchanges a stock can be listed on
+const (
+	ExchangeNSE = "NSE"
+	ExchangeBSE = "BSE"
 )
 
-// SearchStocks looks up company symbols or names
-func SearchStocks(db *sql.DB, query string) ([]model.Stock, error) {
-	hasSpace := strings.Contains(query, " ")
-
-	var rows *sql.Rows
-	var err error
-
-	if hasSpace {
-		// User is likely searching for a company name
-		rows, err = db.Query(`
-			SELECT symbol, company_name FROM stocks
-			WHERE LOWER(company_name) LIKE '%' || LOWER($1) || '%'
-			LIMIT 10
-		`, query)
-	} else {
+// stockColumns are selected, in order, by every query that loads a model.Stock
+const stockColumns = `symbol, company_name, exchange, isin, scrip_code, COALESCE(fmv_2018, 0)`
+
+func scanStocks(rows *sql.Rows) ([]model.Stock, error) {
+	defer rows.Close()
+
+	var stocks []model.Stock
+	for rows.Next() {
+		var stock model.Stock
+		if err := rows.Scan(&stock.Symbol, &stock.CompanyName, &stock.Exchange, &stock.ISIN, &stock.ScripCode, &stock.FMV2018); err != nil {
+			return nil, err
+		}
+		stocks = append(stocks, stock)
+	}
+	return stocks, rows.Err()
+}
+
+// StockQuery is what a user asked for after "stock", "alert" or "index"
+type StockQuery struct {
+	Text     string
+	Exchange string   // NSE or BSE when the user named one
+	Horizons []string // performance horizons the user asked for, if any
+}
+
+// ParseStockQuery splits trailing exchange and horizon words off a query, so
+// "reliance bse" searches for "reliance" on BSE only and "tcs 3y 5y" shows
+// just the 3Y and 5Y performance of TCS
+func ParseStockQuery(query string) StockQuery {
+	words := strings.Fields(query)
+	var parsed StockQuery
+	for len(words) > 1 {
+		last := strings.ToUpper(words[len(words)-1])
+		switch {
+		case (last == ExchangeNSE || last == ExchangeBSE) && parsed.Exchange == "":
+			parsed.Exchange = last
+		case slices.Contains(helper.AppConstant().Horizons, last):
+			parsed.Horizons = append([]string{last}, parsed.Horizons...)
+		default:
+			parsed.Text = strings.Join(words, " ")
+			return parsed
+		}
+		words = words[:len(words)-1]
+	}
+	parsed.Text = strings.Join(words, " ")
+	return parsed
+}
+
+// SearchStocks looks up indices, company symbols, names or BSE scrip codes, limited to
+// exchange unless it is empty. Without an exchange every listing of a matched
+// company is returned, so it can be quoted on each exchange.
+func SearchStocks(ctx context.Context, db *sql.DB, query, exchange string) ([]model.Stock, error) {
+	// Indices aren't in the stocks table, but "stock nifty" should still work
+	if index, ok := FindIndex(query, false); ok && exchange == "" {
+		metrics.StockSearchResults.WithLabelValues("index").Inc()
+		return []model.Stock{index.Stock()}, nil
+	}
+
+	start := time.Now()
+	stocks, err := searchStocks(ctx, db, query, exchange)
+	if err == nil && exchange == "" {
+		stocks, err = withOtherListings(ctx, db, stocks)
+	}
+	metrics.StockSearchDuration.Observe(time.Since(start).Seconds())
+	if err == nil {
+		result := "miss"
+		if len(stocks) > 0 {
+			result = "hit"
+		}
+		metrics.StockSearchResults.WithLabelValues(result).Inc()
+	}
+	return stocks, err
+}
+
+func searchStocks(ctx context.Context, db *sql.DB, query, exchange string) ([]model.Stock, error) {
+	const onExchange = ` AND ($2 = '' OR exchange = $2)`
+
+	if isScripCode(query) {
+		rows, err := db.QueryContext(ctx, `
+			SELECT `+stockColumns+` FROM stocks
+			WHERE scrip_code = $1`+onExchange, query, exchange)
+		if err != nil {
+			return nil, err
+		}
+		return scanStocks(rows)
+	}
+
+	if !strings.Contains(query, " ") {
 		// User is likely searching for a symbol
 		// First try exact match
-		rows, err = db.Query(`
-			SELECT symbol, company_name FROM stocks
-			WHERE LOWER(symbol) = LOWER($1)
-			LIMIT 1
-		`, query)
-
-		if err == nil && rows != nil {
-			defer rows.Close()
-			var exactMatch []model.Stock
-			for rows.Next() {
-				var stock model.Stock
-				if err := rows.Scan(&stock.Symbol, &stock.CompanyName); err == nil {
-					exactMatch = append(exactMatch, stock)
-				}
-			}
-			if len(exactMatch) > 0 {
-				return exactMatch, nil
-			}
-		}
-
-		// Fallback to fuzzy match if no exact match found
-		rows, err = db.Query(`
-			SELECT symbol, company_name FROM stocks
-			WHERE LOWER(symbol) LIKE '%' || LOWER($1) || '%'
-			OR LOWER(company_name) LIKE '%' || LOWER($1) || '%'
-			LIMIT 10
-		`, query)
+		rows, err := db.QueryContext(ctx, `
+			SELECT `+stockColumns+` FROM stocks
+			WHERE LOWER(symbol) = LOWER($1)`+onExchange+`
+			ORDER BY exchange DESC
+		`, query, exchange)
+		if err != nil {
+			return nil, err
+		}
+		exactMatch, err := scanStocks(rows)
+		if err != nil || len(exactMatch) > 0 {
+			return exactMatch, err
+		}
 	}
 
+	// User is likely searching for a company name, or no symbol matched exactly
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+stockColumns+` FROM stocks
+		WHERE (LOWER(symbol) LIKE '%' || LOWER($1) || '%'
+		       OR LOWER(company_name) LIKE '%' || LOWER($1) || '%')`+onExchange+`
+		LIMIT 10
+	`, query, exchange)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return scanStocks(rows)
+}
 
-	var stocks []model.Stock
-	for rows.Next() {
-		var stock model.Stock
-		if err := rows.Scan(&stock.Symbol, &stock.CompanyName); err == nil {
-			stocks = append(stocks, stock)
+// withOtherListings adds the listings on other exchanges of the companies in
+// stocks, matched by ISIN
+func withOtherListings(ctx context.Context, db *sql.DB, stocks []model.Stock) ([]model.Stock, error) {
+	var isins pq.StringArray
+	for _, stock := range stocks {
+		if stock.ISIN != "" {
+			isins = append(isins, stock.ISIN)
+		}
+	}
+	if len(isins) == 0 {
+		return stocks, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT `+stockColumns+` FROM stocks WHERE isin = ANY($1)`, isins)
+	if err != nil {
+		return nil, err
+	}
+	others, err := scanStocks(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, stock := range stocks {
+		seen[stock.Exchange+":"+stock.Symbol] = true
+	}
+	for _, other := range others {
+		if !seen[other.Exchange+":"+other.Symbol] {
+			stocks = append(stocks, other)
 		}
 	}
 	return stocks, nil
 }
 
-// GetYahooFinancePrice fetches the current price from Yahoo Finance
-func GetStockPerformance(symbol string, companyName string) (model.StockPerformance, error) {
-	url := fmt.Sprintf(os.Getenv(helper.EnvironmentConstant().STOCK_PRICE_URL)+"%s", symbol)
+// GroupListings groups listings of the same company (same ISIN, or same name
+// when the ISIN is unknown), keeping search order and NSE first in each group
+func GroupListings(stocks []model.Stock) [][]model.Stock {
+	var groups [][]model.Stock
+	index := make(map[string]int)
+	for _, stock := range stocks {
+		key := stock.ISIN
+		if key == "" {
+			key = "name:" + strings.ToUpper(stock.CompanyName)
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], stock)
+	}
+	for _, group := range groups {
+		sort.SliceStable(group, func(a, b int) bool {
+			return group[a].Exchange == ExchangeNSE && group[b].Exchange != ExchangeNSE
+		})
+	}
+	return groups
+}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return model.StockPerformance{}, err
+func isScripCode(query string) bool {
+	if query == "" {
+		return false
 	}
-	defer resp.Body.Close()
+	for _, r := range query {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return model.StockPerformance{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// ErrStockNotFound is returned when an edited stock doesn't exist
+var ErrStockNotFound = errors.New("stock not found")
+
+// ListStocks returns stocks whose symbol or company name contains query, by symbol
+func ListStocks(ctx context.Context, db *sql.DB, query string, limit, offset int) ([]model.Stock, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+stockColumns+` FROM stocks
+		WHERE $1 = '' OR LOWER(symbol) LIKE '%' || LOWER($1) || '%'
+		   OR LOWER(company_name) LIKE '%' || LOWER($1) || '%'
+		   OR scrip_code = $1 OR isin = UPPER($1)
+		ORDER BY symbol, exchange
+		LIMIT $2 OFFSET $3
+	`, query, limit, offset)
+	if err != nil {
+		return nil, err
 	}
+	return scanStocks(rows)
+}
 
-	var apiResp model.StockAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		return model.StockPerformance{}, err
+// CreateStock adds a listing to the stocks table, on NSE unless stock says otherwise
+func CreateStock(ctx context.Context, db *sql.DB, stock model.Stock) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO stocks (symbol, company_name, exchange, isin, scrip_code, fmv_2018)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0))
+	`, strings.ToUpper(stock.Symbol), stock.CompanyName, listingExchange(stock.Exchange),
+		strings.ToUpper(stock.ISIN), stock.ScripCode, stock.FMV2018)
+	return err
+}
+
+// UpdateStock changes the company name, ISIN, scrip code and 31 Jan 2018
+// price of symbol on exchange
+func UpdateStock(ctx context.Context, db *sql.DB, symbol, exchange string, stock model.Stock) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE stocks SET company_name = $3, isin = $4, scrip_code = $5, fmv_2018 = NULLIF($6, 0)
+		WHERE UPPER(symbol) = UPPER($1) AND exchange = $2
+	`, symbol, listingExchange(exchange), stock.CompanyName, strings.ToUpper(stock.ISIN), stock.ScripCode, stock.FMV2018)
+	return expectOneRow(result, err)
+}
+
+// DeleteStock removes the listing of symbol on exchange from the stocks table
+func DeleteStock(ctx context.Context, db *sql.DB, symbol, exchange string) error {
+	result, err := db.ExecContext(ctx, `
+		DELETE FROM stocks WHERE UPPER(symbol) = UPPER($1) AND exchange = $2
+	`, symbol, listingExchange(exchange))
+	return expectOneRow(result, err)
+}
+
+// listingExchange normalises an exchange name, defaulting to NSE
+func listingExchange(exchange string) string {
+	if exchange == "" {
+		return ExchangeNSE
 	}
+	return strings.ToUpper(exchange)
+}
 
-	// Prepare Entries map with growth calculation
-	entries := make(map[string]model.HistoricalEntry)
+func expectOneRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStockNotFound
+	}
+	return nil
+}
 
-	// 1M growth
-	if apiResp.Price1m != 0 {
-		growth := ((apiResp.CurrentPrice - apiResp.Price1m) / apiResp.Price1m) * 100
-		entries["1M"] = model.HistoricalEntry{
-			FromPrice: apiResp.Price1m,
-			ToPrice:   apiResp.CurrentPrice,
-			Growth:    growth,
+// GetListingsPerformance quotes a company on each exchange it is listed on.
+// The first listing that could be quoted provides the details; the others only
+// add their price to Listings. It fails only when no listing could be quoted.
+func GetListingsPerformance(ctx context.Context, chain *QuoteChain, listings []model.Stock) (model.StockPerformance, error) {
+	var perf model.StockPerformance
+	var prices []model.ListingPrice
+	var firstErr error
+	for _, listing := range listings {
+		p, err := GetStockPerformance(ctx, chain, listing)
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed to quote listing", "symbol", listing.Symbol, "exchange", listing.Exchange, "error", err)
+			firstErr = cmp.Or(firstErr, err)
+			continue
 		}
+		if len(prices) == 0 {
+			perf = p
+		}
+		prices = append(prices, model.ListingPrice{Exchange: p.Exchange, Price: p.Current})
+	}
+	if len(prices) == 0 {
+		return model.StockPerformance{}, firstErr
 	}
+	if len(prices) > 1 {
+		perf.Listings = prices
+	}
+	return perf, nil
+}
 
-	// 1Y growth
-	if apiResp.Price1y != 0 {
-		growth := ((apiResp.CurrentPrice - apiResp.Price1y) / apiResp.Price1y) * 100
-		entries["1Y"] = model.HistoricalEntry{
-			FromPrice: apiResp.Price1y,
-			ToPrice:   apiResp.CurrentPrice,
-			Growth:    growth,
+// GetStockPerformance fetches the current price and history of a listing from
+// the first healthy provider, serving recent quotes from the cache
+func GetStockPerformance(ctx context.Context, chain *QuoteChain, stock model.Stock) (model.StockPerformance, error) {
+	exchange := listingExchange(stock.Exchange)
+	key := exchange + ":" + stock.Symbol
+	cached, ok := quotes.get(key)
+	metrics.ObserveCache("quote", ok)
+	if !ok {
+		apiResp, source, err := chain.Quote(ctx, stock.Symbol, exchange)
+		if err != nil {
+			return model.StockPerformance{}, err
 		}
+		cached = cachedQuote{response: apiResp, source: source, fetchedAt: time.Now()}
+		quotes.set(key, cached, chain.cacheTTL)
 	}
+	apiResp := cached.response
 
-	// 5Y growth
-	if apiResp.Price5y != 0 {
-		growth := ((apiResp.CurrentPrice - apiResp.Price5y) / apiResp.Price5y) * 100
-		entries["5Y"] = model.HistoricalEntry{
-			FromPrice: apiResp.Price5y,
+	// Growth over every horizon the provider has a price for
+	entries := make(map[string]model.HistoricalEntry)
+	for _, horizon := range helper.AppConstant().Horizons {
+		from := horizonPrice(apiResp, horizon)
+		if from == 0 {
+			continue
+		}
+		entry := model.HistoricalEntry{
+			FromPrice: from,
 			ToPrice:   apiResp.CurrentPrice,
-			Growth:    growth,
+			Growth:    helper.Growth(from, apiResp.CurrentPrice),
+			Years:     helper.HorizonYears(horizon),
+		}
+		if entry.Years >= 1 {
+			entry.CAGR = helper.CAGR(from, apiResp.CurrentPrice, entry.Years)
 		}
+		entries[horizon] = entry
+	}
+
+	// Prefer the provider's own quote time; our fetch time says nothing about
+	// when the price was last traded
+	timestamp := cached.fetchedAt
+	if apiResp.QuoteTime > 0 {
+		timestamp = time.Unix(apiResp.QuoteTime, 0)
 	}
 
 	// Create StockPerformance object
+	now := time.Now()
 	stockPerf := model.StockPerformance{
-		CompanyName: companyName,
-		Symbol:      apiResp.Symbol,
+		CompanyName: stock.CompanyName,
+		Symbol:      stock.Symbol,
 		Current:     apiResp.CurrentPrice,
 		Open:        apiResp.OpenPrice,
-		Timestamp:   time.Now(),
+		Timestamp:   timestamp,
 		Entries:     entries,
+		Source:      cached.source,
+		Exchange:    exchange,
+		IsIndex:     exchange == ExchangeIndex,
+		MarketOpen:  market.IsOpen(now),
+	}
+	if !stockPerf.MarketOpen {
+		stockPerf.LastClose = market.PreviousClose(now)
 	}
 
 	return stockPerf, nil
 }
 
-func FormatGrowthMessage(stats model.StockGrowthStats) string {
-	var sb strings.Builder
-
-	current := stats.Entries["1M"].ToPrice // use any entry to fetch current price safely
-
-	sb.WriteString(fmt.Sprintf(
-		"💼 *%s* Stock Update\n", strings.ToUpper(stats.Symbol),
-	))
-	sb.WriteString(fmt.Sprintf(
-		"💰 *Current Price*: ₹%.2f\n", current,
-	))
-	sb.WriteString(fmt.Sprintf(
-		"🕒 *As of*: %s\n\n", stats.Timestamp.Format("02 Jan 2006 15:04"),
-	))
-
-	sb.WriteString("📈 *Performance Overview:*\n")
+// horizonPrice is the price horizon ago in resp, or 0 when the provider has none
+func horizonPrice(resp model.StockAPIResponse, horizon string) float64 {
+	switch horizon {
+	case "1W":
+		return resp.Price1w
+	case "1M":
+		return resp.Price1m
+	case "3M":
+		return resp.Price3m
+	case "6M":
+		return resp.Price6m
+	case "YTD":
+		return resp.PriceYtd
+	case "1Y":
+		return resp.Price1y
+	case "3Y":
+		return resp.Price3y
+	case "5Y":
+		return resp.Price5y
+	}
+	return 0
+}
 
-	for _, label := range []string{"1M", "1Y", "5Y"} {
-		entry, ok := stats.Entries[label]
-		if !ok {
+// SelectHorizons keeps only the entries for horizons in perf and records
+// them, in the order given, as the horizons to show
+func SelectHorizons(perf model.StockPerformance, horizons []string) model.StockPerformance {
+	entries := make(map[string]model.HistoricalEntry, len(horizons))
+	var selected []string
+	for _, horizon := range horizons {
+		horizon = strings.ToUpper(horizon)
+		if _, seen := entries[horizon]; seen {
 			continue
 		}
-
-		emoji := "📈"
-		trend := "gain"
-		if entry.Growth < 0 {
-			emoji = "📉"
-			trend = "loss"
-		} else if entry.Growth == 0 {
-			emoji = "⚖️"
-			trend = "no change"
+		if entry, ok := perf.Entries[horizon]; ok {
+			entries[horizon] = entry
+			selected = append(selected, horizon)
 		}
-
-		comment := ""
-		switch {
-		case entry.Growth > 100:
-			comment = "🚀 Massive rally!"
-		case entry.Growth > 50:
-			comment = "🔥 Strong performer!"
-		case entry.Growth > 10:
-			comment = "👍 Decent growth"
-		case entry.Growth > 0:
-			comment = "📊 Mild uptick"
-		case entry.Growth > -10:
-			comment = "🔻 Slight dip"
-		case entry.Growth > -50:
-			comment = "⚠️ Weak trend"
-		default:
-			comment = "💥 Major crash!"
-		}
-
-		sb.WriteString(fmt.Sprintf(
-			"%s *%s*: %.2f%% %s (₹%.2f → ₹%.2f) %s\n",
-			emoji, label, entry.Growth, trend, entry.FromPrice, entry.ToPrice, comment,
-		))
 	}
-
-	sb.WriteString("\n📬 _This is an automated stock alert. Stay informed!_")
-
-	return sb.String()
+	perf.Entries = entries
+	perf.Horizons = selected
+	return perf
 }
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stocks-info-channel/format"
+	"stocks-info-channel/market"
+	"stocks-info-channel/model"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidFinancialYear is returned for a financial year that can't be
+// understood or hasn't started yet
+var ErrInvalidFinancialYear = errors.New("invalid financial year")
+
+var (
+	// grandfatheringDate is the cut-off of the 2018 budget: shares bought
+	// before it may use their 31 Jan 2018 price as cost
+	grandfatheringDate = time.Date(2018, time.February, 1, 0, 0, 0, 0, time.UTC)
+	// ltcgTaxedFrom is when long-term gains on listed equity became taxable
+	ltcgTaxedFrom = time.Date(2018, time.April, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// equityTaxRate is the tax on gains from listed equity sold on or after From,
+// in percentage
+type equityTaxRate struct {
+	From      time.Time
+	ShortTerm float64
+	LongTerm  float64
+}
+
+// equityTaxRates are newest first. Before April 2018 long-term gains were
+// exempt under section 10(38); the 2024 budget raised both rates from 23 July.
+var equityTaxRates = []equityTaxRate{
+	{From: time.Date(2024, time.July, 23, 0, 0, 0, 0, time.UTC), ShortTerm: 20, LongTerm: 12.5},
+	{From: ltcgTaxedFrom, ShortTerm: 15, LongTerm: 10},
+	{ShortTerm: 15, LongTerm: 0},
+}
+
+// ltcgExemption is how much long-term gain is tax free in the financial year
+// starting in fy under section 112A
+func ltcgExemption(fy int) float64 {
+	switch {
+	case fy >= 2024:
+		return 125000
+	case fy >= 2018:
+		return 100000
+	default:
+		return 0
+	}
+}
+
+// financialYearPattern matches "fy2025-26", "2025-26", "2025-2026" or "2025"
+var financialYearPattern = regexp.MustCompile(`^(?:fy\s*)?(\d{4})(?:\s*[-/]\s*(\d{2}|\d{4}))?$`)
+
+// ParseFinancialYear reads the year asked for after "tax" and returns the
+// year it starts in. No year means the current one in IST.
+func ParseFinancialYear(query string, now time.Time) (int, error) {
+	today := market.In(now)
+	current := today.Year()
+	if today.Month() < time.April {
+		current--
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return current, nil
+	}
+	m := financialYearPattern.FindStringSubmatch(query)
+	if m == nil {
+		return 0, ErrInvalidFinancialYear
+	}
+	fy, _ := strconv.Atoi(m[1])
+	if end := m[2]; end != "" {
+		endYear, _ := strconv.Atoi(end)
+		if len(end) == 2 && endYear != (fy+1)%100 || len(end) == 4 && endYear != fy+1 {
+			return 0, ErrInvalidFinancialYear
+		}
+	}
+	if fy > current {
+		return 0, ErrInvalidFinancialYear
+	}
+	return fy, nil
+}
+
+// CapitalGains reports the gains the user realised in the financial year
+// starting in fy, from their recorded transactions
+func CapitalGains(ctx context.Context, db *sql.DB, user *model.User, fy int) (model.CapitalGainsReport, error) {
+	transactions, err := ListTransactions(ctx, db, user)
+	if err != nil {
+		return model.CapitalGainsReport{}, err
+	}
+	_, disposals, err := BuildHoldings(transactions)
+	if err != nil {
+		return model.CapitalGainsReport{}, err
+	}
+
+	start := time.Date(fy, time.April, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+	var sold []model.Disposal
+	for _, disposal := range disposals {
+		if !disposal.SoldOn.Before(start) && disposal.SoldOn.Before(end) {
+			sold = append(sold, disposal)
+		}
+	}
+
+	prices, err := grandfatheredPrices(ctx, db, sold)
+	if err != nil {
+		return model.CapitalGainsReport{}, err
+	}
+	return capitalGainsReport(fy, sold, prices), nil
+}
+
+// grandfatheredPrices looks up the 31 Jan 2018 price of every listing sold
+// from a lot bought before grandfatheringDate, keyed by "EXCHANGE:SYMBOL"
+// and by ISIN
+func grandfatheredPrices(ctx context.Context, db *sql.DB, disposals []model.Disposal) (map[string]float64, error) {
+	var listings, isins []string
+	for _, disposal := range disposals {
+		if disposal.BoughtOn.Before(grandfatheringDate) {
+			listings = append(listings, disposal.Exchange+":"+disposal.Symbol)
+			if disposal.ISIN != "" {
+				isins = append(isins, disposal.ISIN)
+			}
+		}
+	}
+	prices := make(map[string]float64)
+	if len(listings) == 0 {
+		return prices, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+stockColumns+` FROM stocks
+		WHERE fmv_2018 IS NOT NULL AND (exchange || ':' || UPPER(symbol) = ANY($1) OR isin = ANY($2))
+	`, pq.Array(listings), pq.Array(isins))
+	if err != nil {
+		return nil, err
+	}
+	stocks, err := scanStocks(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, stock := range stocks {
+		prices[stock.Exchange+":"+strings.ToUpper(stock.Symbol)] = stock.FMV2018
+		// The law takes the highest price on any exchange
+		if stock.ISIN != "" {
+			prices[stock.ISIN] = math.Max(prices[stock.ISIN], stock.FMV2018)
+		}
+	}
+	return prices, nil
+}
+
+// capitalGainsReport classifies and totals disposals made in the financial
+// year starting in fy; prices are the grandfathered 31 Jan 2018 prices
+func capitalGainsReport(fy int, disposals []model.Disposal, prices map[string]float64) model.CapitalGainsReport {
+	report := model.CapitalGainsReport{FinancialYear: fy}
+
+	// Net gain of each term at each rate, so losses and the exemption can go
+	// against the most heavily taxed gains first
+	shortTerm := make(map[float64]float64)
+	longTerm := make(map[float64]float64)
+	ratesUsed := make(map[time.Time]bool)
+	for _, disposal := range disposals {
+		gain := model.CapitalGain{
+			Disposal:  disposal,
+			LongTerm:  disposal.SoldOn.After(disposal.BoughtOn.AddDate(1, 0, 0)),
+			CostPrice: disposal.BuyPrice,
+		}
+		rates := rateOn(disposal.SoldOn)
+		ratesUsed[rates.From] = true
+		if disposal.DateUnknown {
+			report.DateUnknown = true
+		}
+
+		if gain.LongTerm && disposal.BoughtOn.Before(grandfatheringDate) && !disposal.SoldOn.Before(ltcgTaxedFrom) {
+			fmv, ok := prices[disposal.Exchange+":"+disposal.Symbol]
+			if !ok && disposal.ISIN != "" {
+				fmv, ok = prices[disposal.ISIN]
+			}
+			if ok {
+				if cost := math.Min(fmv, disposal.SellPrice); cost > gain.CostPrice {
+					gain.CostPrice, gain.Grandfathered = cost, true
+					report.Grandfathered = true
+				}
+			} else {
+				gain.MissingFMV, report.MissingFMV = true, true
+			}
+		}
+
+		gain.Cost = gain.Quantity * gain.CostPrice
+		gain.Proceeds = gain.Quantity * gain.SellPrice
+		gain.Gain = gain.Proceeds - gain.Cost
+		if gain.LongTerm {
+			gain.Rate = rates.LongTerm
+			longTerm[gain.Rate] += gain.Gain
+			report.LongTerm += gain.Gain
+		} else {
+			gain.Rate = rates.ShortTerm
+			shortTerm[gain.Rate] += gain.Gain
+			report.ShortTerm += gain.Gain
+		}
+		report.Gains = append(report.Gains, gain)
+	}
+	report.RatesChanged = len(ratesUsed) > 1
+
+	// Losses go against gains of their own term first; what is left of a
+	// short-term loss may go against long-term gains, never the reverse
+	shortLoss := offsetLosses(shortTerm)
+	longLoss := offsetLosses(longTerm)
+	shortLoss = reduceGains(longTerm, shortLoss)
+	report.CarriedForward = shortLoss + longLoss
+	report.Exemption = ltcgExemption(fy) - reduceGains(longTerm, ltcgExemption(fy))
+
+	for rate, gain := range shortTerm {
+		report.TaxableShortTerm += gain
+		report.EstimatedTax += gain * rate / 100
+	}
+	for rate, gain := range longTerm {
+		report.TaxableLongTerm += gain
+		report.EstimatedTax += gain * rate / 100
+	}
+	return report
+}
+
+// rateOn returns the rates for a sale on day
+func rateOn(day time.Time) equityTaxRate {
+	for _, rates := range equityTaxRates {
+		if !day.Before(rates.From) {
+			return rates
+		}
+	}
+	return equityTaxRates[len(equityTaxRates)-1]
+}
+
+// offsetLosses sets the losses in gains off against the gains in it and
+// returns the loss left over; every entry of gains ends up zero or positive
+func offsetLosses(gains map[float64]float64) float64 {
+	var loss float64
+	for rate, gain := range gains {
+		if gain < 0 {
+			loss -= gain
+			gains[rate] = 0
+		}
+	}
+	return reduceGains(gains, loss)
+}
+
+// reduceGains takes up to amount off gains, highest rate first, and returns
+// what could not be taken
+func reduceGains(gains map[float64]float64, amount float64) float64 {
+	rates := make([]float64, 0, len(gains))
+	for rate := range gains {
+		rates = append(rates, rate)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(rates)))
+
+	for _, rate := range rates {
+		taken := math.Min(gains[rate], amount)
+		gains[rate] -= taken
+		amount -= taken
+	}
+	return amount
+}
+
+// WriteCapitalGainsCSV writes one row per disposal in report, for filing or
+// sharing with an accountant
+func WriteCapitalGainsCSV(w io.Writer, report model.CapitalGainsReport) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{
+		"Symbol", "Exchange", "ISIN", "Quantity", "Bought on", "Sold on", "Term",
+		"Buy price", "Cost price", "Grandfathered", "Sell price", "Cost", "Proceeds", "Gain", "Tax rate %",
+	})
+
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, gain := range report.Gains {
+		term := "STCG"
+		if gain.LongTerm {
+			term = "LTCG"
+		}
+		grandfathered := "no"
+		switch {
+		case gain.Grandfathered:
+			grandfathered = "yes"
+		case gain.MissingFMV:
+			grandfathered = "31 Jan 2018 price unknown"
+		}
+		boughtOn := gain.BoughtOn.Format("2006-01-02")
+		if gain.DateUnknown {
+			boughtOn = "unknown, imported " + boughtOn
+		}
+		out.Write([]string{
+			gain.Symbol, gain.Exchange, gain.ISIN, strconv.FormatFloat(gain.Quantity, 'f', -1, 64),
+			boughtOn, gain.SoldOn.Format("2006-01-02"), term,
+			amount(gain.BuyPrice), amount(gain.CostPrice), grandfathered, amount(gain.SellPrice),
+			amount(gain.Cost), amount(gain.Proceeds), amount(gain.Gain), strconv.FormatFloat(gain.Rate, 'f', -1, 64),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// CapitalGainsFileName names the CSV download of a financial year
+func CapitalGainsFileName(fy int) string {
+	return "capital-gains-" + format.FinancialYear(fy) + ".csv"
+}
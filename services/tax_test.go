@@ -0,0 +1,300 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"stocks-info-channel/model"
+)
+
+func TestCapitalGainClassification(t *testing.T) {
+	tests := []struct {
+		name                string
+		boughtOn, soldOn    time.Time
+		buyPrice, sellPrice float64
+		fmv                 float64 // 31 Jan 2018 price on record; 0 for none
+		wantLongTerm        bool
+		wantCostPrice       float64
+		wantGrandfathered   bool
+		wantMissingFMV      bool
+		wantRate            float64
+	}{
+		{
+			name:     "short term before the 2024 budget",
+			boughtOn: day(2024, time.January, 10), soldOn: day(2024, time.July, 22),
+			buyPrice: 100, sellPrice: 120,
+			wantCostPrice: 100, wantRate: 15,
+		},
+		{
+			name:     "short term from the 2024 budget",
+			boughtOn: day(2024, time.January, 10), soldOn: day(2024, time.July, 23),
+			buyPrice: 100, sellPrice: 120,
+			wantCostPrice: 100, wantRate: 20,
+		},
+		{
+			name:     "long term before the 2024 budget",
+			boughtOn: day(2022, time.January, 10), soldOn: day(2024, time.July, 22),
+			buyPrice: 100, sellPrice: 120,
+			wantLongTerm: true, wantCostPrice: 100, wantRate: 10,
+		},
+		{
+			name:     "long term from the 2024 budget",
+			boughtOn: day(2022, time.January, 10), soldOn: day(2024, time.July, 23),
+			buyPrice: 100, sellPrice: 120,
+			wantLongTerm: true, wantCostPrice: 100, wantRate: 12.5,
+		},
+		{
+			name:     "exactly twelve months is short term",
+			boughtOn: day(2023, time.July, 23), soldOn: day(2024, time.July, 23),
+			buyPrice: 100, sellPrice: 120,
+			wantCostPrice: 100, wantRate: 20,
+		},
+		{
+			name:     "a day over twelve months is long term",
+			boughtOn: day(2023, time.July, 23), soldOn: day(2024, time.July, 24),
+			buyPrice: 100, sellPrice: 120,
+			wantLongTerm: true, wantCostPrice: 100, wantRate: 12.5,
+		},
+		{
+			name:     "bought on 31 Jan 2018 is grandfathered",
+			boughtOn: day(2018, time.January, 31), soldOn: day(2024, time.June, 1),
+			buyPrice: 100, sellPrice: 400, fmv: 300,
+			wantLongTerm: true, wantCostPrice: 300, wantGrandfathered: true, wantRate: 10,
+		},
+		{
+			name:     "bought on 1 Feb 2018 is not grandfathered",
+			boughtOn: day(2018, time.February, 1), soldOn: day(2024, time.June, 1),
+			buyPrice: 100, sellPrice: 400, fmv: 300,
+			wantLongTerm: true, wantCostPrice: 100, wantRate: 10,
+		},
+		{
+			name:     "grandfathered cost is capped at the sale price",
+			boughtOn: day(2016, time.May, 1), soldOn: day(2024, time.August, 1),
+			buyPrice: 100, sellPrice: 400, fmv: 500,
+			wantLongTerm: true, wantCostPrice: 400, wantGrandfathered: true, wantRate: 12.5,
+		},
+		{
+			name:     "actual cost above the 2018 price is kept",
+			boughtOn: day(2016, time.May, 1), soldOn: day(2024, time.August, 1),
+			buyPrice: 600, sellPrice: 700, fmv: 300,
+			wantLongTerm: true, wantCostPrice: 600, wantRate: 12.5,
+		},
+		{
+			name:     "unknown 2018 price is flagged",
+			boughtOn: day(2016, time.May, 1), soldOn: day(2024, time.August, 1),
+			buyPrice: 100, sellPrice: 400,
+			wantLongTerm: true, wantCostPrice: 100, wantMissingFMV: true, wantRate: 12.5,
+		},
+		{
+			name:     "long term gains were exempt before April 2018",
+			boughtOn: day(2016, time.May, 1), soldOn: day(2018, time.March, 1),
+			buyPrice: 100, sellPrice: 400, fmv: 300,
+			wantLongTerm: true, wantCostPrice: 100, wantRate: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disposal := model.Disposal{
+				Symbol: "TCS", Exchange: ExchangeNSE, Quantity: 10,
+				BuyPrice: tt.buyPrice, BoughtOn: tt.boughtOn, SellPrice: tt.sellPrice, SoldOn: tt.soldOn,
+			}
+			prices := map[string]float64{}
+			if tt.fmv > 0 {
+				prices["NSE:TCS"] = tt.fmv
+			}
+			fy := tt.soldOn.Year()
+			if tt.soldOn.Month() < time.April {
+				fy--
+			}
+
+			report := capitalGainsReport(fy, []model.Disposal{disposal}, prices)
+			if len(report.Gains) != 1 {
+				t.Fatalf("got %d gains, want 1", len(report.Gains))
+			}
+			gain := report.Gains[0]
+			if gain.LongTerm != tt.wantLongTerm {
+				t.Errorf("LongTerm = %v, want %v", gain.LongTerm, tt.wantLongTerm)
+			}
+			if gain.CostPrice != tt.wantCostPrice {
+				t.Errorf("CostPrice = %v, want %v", gain.CostPrice, tt.wantCostPrice)
+			}
+			if gain.Grandfathered != tt.wantGrandfathered {
+				t.Errorf("Grandfathered = %v, want %v", gain.Grandfathered, tt.wantGrandfathered)
+			}
+			if gain.MissingFMV != tt.wantMissingFMV {
+				t.Errorf("MissingFMV = %v, want %v", gain.MissingFMV, tt.wantMissingFMV)
+			}
+			if gain.Rate != tt.wantRate {
+				t.Errorf("Rate = %v, want %v", gain.Rate, tt.wantRate)
+			}
+			if want := 10 * (tt.sellPrice - tt.wantCostPrice); gain.Gain != want {
+				t.Errorf("Gain = %v, want %v", gain.Gain, want)
+			}
+		})
+	}
+}
+
+func TestCapitalGainsReportTotals(t *testing.T) {
+	// sale returns a 1-share disposal with the given gain
+	sale := func(boughtOn, soldOn time.Time, gain float64) model.Disposal {
+		return model.Disposal{
+			Symbol: "TCS", Exchange: ExchangeNSE, Quantity: 1,
+			BuyPrice: 1000000, BoughtOn: boughtOn, SellPrice: 1000000 + gain, SoldOn: soldOn,
+		}
+	}
+	longBefore := func(gain float64) model.Disposal {
+		return sale(day(2020, time.January, 1), day(2024, time.June, 1), gain)
+	}
+	longAfter := func(gain float64) model.Disposal {
+		return sale(day(2020, time.January, 1), day(2024, time.September, 1), gain)
+	}
+	shortAfter := func(gain float64) model.Disposal {
+		return sale(day(2024, time.May, 1), day(2024, time.September, 1), gain)
+	}
+
+	tests := []struct {
+		name             string
+		fy               int
+		disposals        []model.Disposal
+		wantShortTerm    float64
+		wantLongTerm     float64
+		wantExemption    float64
+		wantTaxableShort float64
+		wantTaxableLong  float64
+		wantTax          float64
+		wantCarried      float64
+		wantRatesChanged bool
+	}{
+		{
+			name:          "gains under the exemption are tax free",
+			fy:            2024,
+			disposals:     []model.Disposal{longAfter(100000)},
+			wantLongTerm:  100000,
+			wantExemption: 100000,
+		},
+		{
+			name:            "FY2024-25 exemption is 1.25 lakh",
+			fy:              2024,
+			disposals:       []model.Disposal{longAfter(200000)},
+			wantLongTerm:    200000,
+			wantExemption:   125000,
+			wantTaxableLong: 75000,
+			wantTax:         9375,
+		},
+		{
+			name:            "FY2023-24 exemption is 1 lakh",
+			fy:              2023,
+			disposals:       []model.Disposal{sale(day(2020, time.January, 1), day(2023, time.June, 1), 200000)},
+			wantLongTerm:    200000,
+			wantExemption:   100000,
+			wantTaxableLong: 100000,
+			wantTax:         10000,
+		},
+		{
+			name:             "exemption goes against the higher rate first",
+			fy:               2024,
+			disposals:        []model.Disposal{longBefore(100000), longAfter(100000)},
+			wantLongTerm:     200000,
+			wantExemption:    125000,
+			wantTaxableLong:  75000,
+			wantTax:          7500,
+			wantRatesChanged: true,
+		},
+		{
+			name:            "short-term losses go against long-term gains",
+			fy:              2024,
+			disposals:       []model.Disposal{shortAfter(-50000), longAfter(200000)},
+			wantShortTerm:   -50000,
+			wantLongTerm:    200000,
+			wantExemption:   125000,
+			wantTaxableLong: 25000,
+			wantTax:         3125,
+		},
+		{
+			name:             "long-term losses don't go against short-term gains",
+			fy:               2024,
+			disposals:        []model.Disposal{shortAfter(50000), longAfter(-30000)},
+			wantShortTerm:    50000,
+			wantLongTerm:     -30000,
+			wantTaxableShort: 50000,
+			wantTax:          10000,
+			wantCarried:      30000,
+		},
+		{
+			name:          "losses beyond the gains are carried forward",
+			fy:            2024,
+			disposals:     []model.Disposal{shortAfter(-80000), longAfter(50000)},
+			wantShortTerm: -80000,
+			wantLongTerm:  50000,
+			wantCarried:   30000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := capitalGainsReport(tt.fy, tt.disposals, nil)
+			checks := []struct {
+				field     string
+				got, want float64
+			}{
+				{"ShortTerm", report.ShortTerm, tt.wantShortTerm},
+				{"LongTerm", report.LongTerm, tt.wantLongTerm},
+				{"Exemption", report.Exemption, tt.wantExemption},
+				{"TaxableShortTerm", report.TaxableShortTerm, tt.wantTaxableShort},
+				{"TaxableLongTerm", report.TaxableLongTerm, tt.wantTaxableLong},
+				{"EstimatedTax", report.EstimatedTax, tt.wantTax},
+				{"CarriedForward", report.CarriedForward, tt.wantCarried},
+			}
+			for _, c := range checks {
+				if math.Abs(c.got-c.want) > 0.005 {
+					t.Errorf("%s = %.2f, want %.2f", c.field, c.got, c.want)
+				}
+			}
+			if report.RatesChanged != tt.wantRatesChanged {
+				t.Errorf("RatesChanged = %v, want %v", report.RatesChanged, tt.wantRatesChanged)
+			}
+		})
+	}
+}
+
+func TestParseFinancialYear(t *testing.T) {
+	october := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query   string
+		now     time.Time
+		want    int
+		wantErr bool
+	}{
+		{query: "", now: october, want: 2026},
+		{query: "", now: time.Date(2026, time.March, 31, 12, 0, 0, 0, time.UTC), want: 2025},
+		// 31 Mar 20:00 UTC is already 1 Apr in IST
+		{query: "", now: time.Date(2026, time.March, 31, 20, 0, 0, 0, time.UTC), want: 2026},
+		{query: "fy2025-26", now: october, want: 2025},
+		{query: "FY2024-25", now: october, want: 2024},
+		{query: "fy 2023-2024", now: october, want: 2023},
+		{query: "2022/23", now: october, want: 2022},
+		{query: "2021", now: october, want: 2021},
+		{query: "2025-27", now: october, wantErr: true},
+		{query: "2025-2027", now: october, wantErr: true},
+		{query: "2027-28", now: october, wantErr: true},
+		{query: "last year", now: october, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := ParseFinancialYear(tt.query, tt.now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidFinancialYear) {
+					t.Fatalf("ParseFinancialYear(%q) error = %v, want ErrInvalidFinancialYear", tt.query, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("ParseFinancialYear(%q) = %d, %v; want %d", tt.query, got, err, tt.want)
+			}
+		})
+	}
+}
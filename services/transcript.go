@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+
+	"stocks-info-channel/config"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/model"
+)
+
+// Message directions stored in the transcript
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
+
+// RecordMessage appends a message to the user's transcript
+func RecordMessage(ctx context.Context, db *sql.DB, user *model.User, direction, body string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO messages (user_id, direction, body)
+		VALUES ($1, $2, $3)
+	`, user.ID, direction, body)
+	return err
+}
+
+// SendAndRecord sends body to the user and keeps it in their transcript
+func SendAndRecord(ctx context.Context, db *sql.DB, cfg *config.Config, user *model.User, body string) error {
+	if _, err := SendWhatsApp(ctx, cfg, user.PhoneNumber, body); err != nil {
+		return err
+	}
+	if err := RecordMessage(ctx, db, user, DirectionOutbound, body); err != nil {
+		logging.FromContext(ctx).Warn("failed to record outbound message", "error", err)
+	}
+	return nil
+}
+
+// GetTranscript returns the user's latest messages, oldest first
+func GetTranscript(ctx context.Context, db *sql.DB, user *model.User, limit int) ([]model.Message, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, direction, body, created_at FROM (
+			SELECT id, direction, body, created_at FROM messages
+			WHERE user_id = $1
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+		) latest
+		ORDER BY created_at, id
+	`, user.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []model.Message
+	for rows.Next() {
+		var m model.Message
+		if err := rows.Scan(&m.ID, &m.Direction, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
@@ -1,23 +1,187 @@
 package services
 
 import (
-	"log"
-	"os"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"stocks-info-channel/config"
 	"stocks-info-channel/helper"
+	"stocks-info-channel/logging"
+	"stocks-info-channel/metrics"
+	"stocks-info-channel/model"
 
 	"github.com/twilio/twilio-go"
+	"github.com/twilio/twilio-go/client"
 	openApi "github.com/twilio/twilio-go/rest/api/v2010"
 )
 
-func SendWhatsApp(to, body string) (*openApi.ApiV2010Message, error) {
+// SendWhatsApp sends body to the user, splitting it into numbered parts when it
+// exceeds the Twilio body limit. Parts are sent in order and sending stops at the
+// first failure; the last sent message is returned.
+func SendWhatsApp(ctx context.Context, cfg *config.Config, to, body string) (*openApi.ApiV2010Message, error) {
+	client := twilio.NewRestClientWithParams(twilio.ClientParams{
+		Username: cfg.TwilioAccountSID,
+		Password: cfg.TwilioAuthToken,
+	})
+	logger := logging.FromContext(ctx)
+
+	parts := helper.SplitMessage(body, helper.AppConstant().MaxMessageLength)
+	if len(parts) > 1 {
+		logger.Info("message is too long, sending it in parts", "parts", len(parts))
+	}
+
+	var message *openApi.ApiV2010Message
+	for _, part := range parts {
+		// The Twilio client has no context support, so stop between parts instead
+		if err := ctx.Err(); err != nil {
+			return message, err
+		}
+
+		params := &openApi.CreateMessageParams{}
+		params.SetFrom(helper.AppConstant().WhatsApp + cfg.PhoneNumber)
+		params.SetTo(helper.AppConstant().WhatsApp + to)
+		params.SetBody(part)
+
+		sent, err := client.Api.CreateMessage(params)
+		metrics.ObserveTwilioSend(err)
+		if err != nil {
+			logger.Error("failed to send whatsapp message", "to", to, "error", err)
+			return message, err
+		}
+		logger.Debug("sent whatsapp message", "to", to, "body", part)
+		message = sent
+	}
+	return message, nil
+}
+
+// SendWhatsAppContent sends a Twilio Content API message (templates, list pickers,
+// quick replies) identified by contentSid and filled in with variables
+func SendWhatsAppContent(ctx context.Context, cfg *config.Config, to, contentSid string, variables map[string]string) (*openApi.ApiV2010Message, error) {
 	client := twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username: os.Getenv(helper.EnvironmentConstant().TWILIO_ACCOUNT_SID),
-		Password: os.Getenv(helper.EnvironmentConstant().TWILIO_AUTH_TOKEN),
+		Username: cfg.TwilioAccountSID,
+		Password: cfg.TwilioAuthToken,
 	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	contentVariables, err := json.Marshal(variables)
+	if err != nil {
+		return nil, err
+	}
+
 	params := &openApi.CreateMessageParams{}
-	log.Println(" Phone Number :- ", os.Getenv(helper.EnvironmentConstant().PHONE_NUMBER))
-	params.SetFrom(helper.AppConstant().WhatsApp + os.Getenv(helper.EnvironmentConstant().PHONE_NUMBER))
+	params.SetFrom(helper.AppConstant().WhatsApp + cfg.PhoneNumber)
 	params.SetTo(helper.AppConstant().WhatsApp + to)
-	params.SetBody(body)
-	return client.Api.CreateMessage(params)
+	params.SetContentSid(contentSid)
+	params.SetContentVariables(string(contentVariables))
+	message, err := client.Api.CreateMessage(params)
+	metrics.ObserveTwilioSend(err)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to send content message", "to", to, "content_sid", contentSid, "error", err)
+		return nil, err
+	}
+	return message, nil
+}
+
+// SendCompanyChoices asks the user to pick one of stocks. It uses a quick-reply or
+// list-picker template sized for the number of options when one is configured and
+// falls back to the plain-text numbered list otherwise or when the send fails.
+// The plain-text version is returned so callers can record what was offered.
+func SendCompanyChoices(ctx context.Context, cfg *config.Config, to, locale string, stocks []model.Stock, action string) string {
+	msg := helper.GenerateCompanyMessage(locale, stocks)
+
+	quickReply := len(stocks) <= helper.AppConstant().MaxQuickReplies
+	var contentSid string
+	if quickReply {
+		contentSid = cfg.TwilioQuickReplySIDs[len(stocks)]
+	}
+	if contentSid == "" && len(stocks) <= helper.AppConstant().MaxListItems {
+		quickReply = false
+		contentSid = cfg.TwilioListPickerSIDs[len(stocks)]
+	}
+
+	if contentSid != "" {
+		variables := helper.CompanyChoiceVariables(locale, stocks, action, quickReply)
+		_, err := SendWhatsAppContent(ctx, cfg, to, contentSid, variables)
+		if err == nil {
+			return msg
+		}
+		logging.FromContext(ctx).Warn("interactive message failed, falling back to plain text", "error", err)
+	}
+
+	SendWhatsApp(ctx, cfg, to, msg)
+	return msg
+}
+
+// twilioMediaHost is the only host DownloadMedia sends credentials to
+const twilioMediaHost = "api.twilio.com"
+
+// ErrUntrustedMedia is returned for a media URL that isn't on Twilio's API
+var ErrUntrustedMedia = errors.New("media URL is not a Twilio URL")
+
+// DownloadMedia fetches a media attachment of an incoming message. Twilio
+// media URLs need the account credentials, so only https://api.twilio.com
+// URLs are fetched; Twilio redirects them to its CDN and the client drops
+// the credentials on that cross-host redirect. Anything over limit bytes is
+// refused.
+func DownloadMedia(ctx context.Context, cfg *config.Config, mediaURL string, limit int64) ([]byte, error) {
+	u, err := url.Parse(mediaURL)
+	if err != nil || u.Scheme != "https" || u.Host != twilioMediaHost || u.User != nil {
+		return nil, ErrUntrustedMedia
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(cfg.TwilioAccountSID, cfg.TwilioAuthToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("media download: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("media is larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// ValidTwilioSignature reports whether signature, the X-Twilio-Signature
+// header of a form POST to webhookURL, was made by Twilio with our auth token
+func ValidTwilioSignature(cfg *config.Config, webhookURL string, form url.Values, signature string) bool {
+	if signature == "" {
+		return false
+	}
+	params := make(map[string]string, len(form))
+	for key := range form {
+		params[key] = form.Get(key)
+	}
+	validator := client.NewRequestValidator(cfg.TwilioAuthToken)
+	return validator.Validate(webhookURL, params, signature)
+}
+
+// IsCSVMedia reports whether an attachment's content type could be a CSV.
+// Phones label CSV files inconsistently, so anything textual is accepted.
+func IsCSVMedia(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return strings.Contains(contentType, "csv") ||
+		strings.HasPrefix(contentType, "text/") ||
+		contentType == "application/vnd.ms-excel" ||
+		contentType == "application/octet-stream"
 }
@@ -3,23 +3,24 @@ package services
 import (
 	"context"
 	"database/sql"
-	"log"
+	"time"
 
 	"stocks-info-channel/helper"
+	"stocks-info-channel/logging"
 	"stocks-info-channel/model"
 
 	"github.com/lib/pq"
 )
 
-// GetOrCreateUser fetches a user by phone or creates a new one
-func GetOrCreateUser(db *sql.DB, phone string) (*model.User, error) {
+// userColumns are selected, in order, by every query that loads a model.User
+const userColumns = `id, phone_number, name, last_message_time,
+	last_two_messages_to_user, last_two_messages_from_user,
+	is_subscribed, subscribed_stocks, tier, locale`
+
+// scanUser reads a row selected with userColumns
+func scanUser(row interface{ Scan(...any) error }) (*model.User, error) {
 	var user model.User
-	err := db.QueryRow(`
-		SELECT id, phone_number, name, last_message_time,
-		       last_two_messages_to_user, last_two_messages_from_user,
-		       is_subscribed, subscribed_stocks
-		FROM users WHERE phone_number = $1
-	`, phone).Scan(
+	err := row.Scan(
 		&user.ID,
 		&user.PhoneNumber,
 		&user.Name,
@@ -28,20 +29,75 @@ func GetOrCreateUser(db *sql.DB, phone string) (*model.User, error) {
 		&user.LastTwoMessagesFromUser,
 		&user.IsSubscribed,
 		&user.SubscribedStocks,
+		&user.Tier,
+		&user.Locale,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByPhone fetches a user by phone, returning sql.ErrNoRows when there is none
+func GetUserByPhone(ctx context.Context, db *sql.DB, phone string) (*model.User, error) {
+	return scanUser(db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE phone_number = $1`, phone))
+}
 
+// GetUserByID fetches a user by ID, returning sql.ErrNoRows when there is none
+func GetUserByID(ctx context.Context, db *sql.DB, id string) (*model.User, error) {
+	return scanUser(db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+// GetOrCreateUser fetches a user by phone or creates a new one
+func GetOrCreateUser(ctx context.Context, db *sql.DB, phone string) (*model.User, error) {
+	user, err := GetUserByPhone(ctx, db, phone)
 	if err == sql.ErrNoRows {
-		log.Println("User not found, creating new user")
-		return createUser(db, phone)
+		logging.FromContext(ctx).Info("user not found, creating new user", "phone", phone)
+		return createUser(ctx, db, phone)
 	} else if err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// UserFilter narrows ListUsers; zero values mean "any"
+type UserFilter struct {
+	Query      string // matches phone, name or a subscribed symbol
+	Subscribed *bool
+	Limit      int // 0 means no limit
+	Offset     int
+}
+
+// ListUsers searches users for the admin API, most recently active first
+func ListUsers(ctx context.Context, db *sql.DB, filter UserFilter) ([]*model.User, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+userColumns+` FROM users
+		WHERE ($1 = '' OR phone_number LIKE '%' || $1 || '%'
+		       OR LOWER(name) LIKE '%' || LOWER($1) || '%'
+		       OR UPPER($1) = ANY(subscribed_stocks))
+		  AND ($2::boolean IS NULL OR is_subscribed = $2)
+		ORDER BY last_message_time DESC NULLS LAST
+		LIMIT NULLIF($3, 0) OFFSET $4
+	`, filter.Query, filter.Subscribed, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
 }
 
 // createUser inserts a new user with default values
-func createUser(db *sql.DB, phone string) (*model.User, error) {
+func createUser(ctx context.Context, db *sql.DB, phone string) (*model.User, error) {
 	user := &model.User{
 		PhoneNumber:             phone,
 		Name:                    sql.NullString{},
@@ -52,15 +108,15 @@ func createUser(db *sql.DB, phone string) (*model.User, error) {
 		SubscribedStocks:        pq.StringArray{},
 	}
 
-	err := db.QueryRow(`
+	err := db.QueryRowContext(ctx, `
 		INSERT INTO users (phone_number, name, last_message_time,
 			last_two_messages_to_user, last_two_messages_from_user,
 			is_subscribed, subscribed_stocks)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id
+		RETURNING id, tier, locale
 	`, user.PhoneNumber, user.Name, user.LastMessageTime,
 		user.LastTwoMessagesToUser, user.LastTwoMessagesFromUser,
-		user.IsSubscribed, user.SubscribedStocks).Scan(&user.ID)
+		user.IsSubscribed, user.SubscribedStocks).Scan(&user.ID, &user.Tier, &user.Locale)
 
 	if err != nil {
 		return nil, err
@@ -69,12 +125,12 @@ func createUser(db *sql.DB, phone string) (*model.User, error) {
 	return user, nil
 }
 
-func CheckForTwoStockSeachTries(db *sql.DB, user *model.User) (bool, error) {
+func CheckForTwoStockSeachTries(ctx context.Context, db *sql.DB, user *model.User) (bool, error) {
 	var lastTwoMessages []string
 
 	// Fetch array directly from Postgres
 	query := `SELECT last_two_messages_to_user FROM users WHERE phone_number = $1`
-	err := db.QueryRow(query, user.PhoneNumber).Scan(pq.Array(&lastTwoMessages))
+	err := db.QueryRowContext(ctx, query, user.PhoneNumber).Scan(pq.Array(&lastTwoMessages))
 	if err != nil {
 		return false, err
 	}
@@ -84,7 +140,7 @@ func CheckForTwoStockSeachTries(db *sql.DB, user *model.User) (bool, error) {
 		return false, nil
 	}
 
-	expected := helper.NoStockFoundMessage()
+	expected := helper.NoStockFoundMessage(user.Locale)
 	// Compare both messages
 	if lastTwoMessages[len(lastTwoMessages)-2] == expected &&
 		lastTwoMessages[len(lastTwoMessages)-1] == expected {
@@ -94,27 +150,27 @@ func CheckForTwoStockSeachTries(db *sql.DB, user *model.User) (bool, error) {
 	return false, nil
 }
 
-func ClearLastTwoMessages(db *sql.DB, user *model.User) error {
+func ClearLastTwoMessages(ctx context.Context, db *sql.DB, user *model.User) error {
 	query := `
 	UPDATE users
  	SET last_two_messages_to_user = '{}'
   	WHERE phone_number = $1
    	`
-	_, err := db.Exec(query, user.PhoneNumber)
+	_, err := db.ExecContext(ctx, query, user.PhoneNumber)
 	return err
 }
 
-func RemoveLastMessage(db *sql.DB, user *model.User) error {
+func RemoveLastMessage(ctx context.Context, db *sql.DB, user *model.User) error {
 	query := `
 		UPDATE users
 		SET last_two_messages_to_user = last_two_messages_to_user[1:array_length(last_two_messages_to_user, 1)-1]
 		WHERE phone_number = $1
 	`
-	_, err := db.Exec(query, user.PhoneNumber)
+	_, err := db.ExecContext(ctx, query, user.PhoneNumber)
 	return err
 }
 
-func UpdateSentMessagesToUser(db *sql.DB, user *model.User, newMessage string) error {
+func UpdateSentMessagesToUser(ctx context.Context, db *sql.DB, user *model.User, newMessage string) error {
 	lastMessageToUser := user.LastTwoMessagesToUser
 
 	// Append new messages and keep only last 2
@@ -128,12 +184,40 @@ func UpdateSentMessagesToUser(db *sql.DB, user *model.User, newMessage string) e
 	SET last_two_messages_to_user = $1
 	WHERE phone_number = $2
 	`
-	_, err := db.ExecContext(context.Background(), updateQuery, lastMessageToUser, user.PhoneNumber)
+	logger := logging.FromContext(ctx)
+	_, err := db.ExecContext(ctx, updateQuery, lastMessageToUser, user.PhoneNumber)
+	if err != nil {
+		logger.Error("❌ failed to update last messages", "phone", user.PhoneNumber, "error", err)
+		return err
+	}
+
+	logger.Info("✅ updated last 2 messages", "phone", user.PhoneNumber)
+	return nil
+}
+
+// SetUserLocale stores the language the user gets replies in
+func SetUserLocale(ctx context.Context, db *sql.DB, user *model.User, locale string) error {
+	_, err := db.ExecContext(ctx, `UPDATE users SET locale = $1 WHERE id = $2`, locale, user.ID)
+	if err != nil {
+		return err
+	}
+	user.Locale = locale
+	return nil
+}
+
+// TouchLastMessageTime records that the user just messaged us, which (re)opens
+// their WhatsApp customer service window
+func TouchLastMessageTime(ctx context.Context, db *sql.DB, user *model.User) error {
+	now := time.Now()
+	_, err := db.ExecContext(ctx, `
+		UPDATE users
+		SET last_message_time = $1
+		WHERE phone_number = $2
+	`, now, user.PhoneNumber)
 	if err != nil {
-		log.Printf("❌ Failed to update messages for user %s: %v", user.PhoneNumber, err)
 		return err
 	}
 
-	log.Printf("✅ Updated last 2 messages for user %s", user.PhoneNumber)
+	user.LastMessageTime = sql.NullTime{Time: now, Valid: true}
 	return nil
 }
@@ -0,0 +1,110 @@
+package upstream
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"stocks-info-channel/metrics"
+)
+
+// ErrCircuitOpen is returned without calling upstream while the breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateHalfOpen
+	stateOpen
+)
+
+// Breaker stops calls to an upstream after threshold consecutive failures.
+// Once cooldown has passed a single trial call is let through: success
+// closes the breaker again, failure reopens it for another cooldown.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trialing bool
+}
+
+// NewBreaker returns a closed breaker
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	b := &Breaker{name: name, threshold: threshold, cooldown: cooldown}
+	b.setState(stateClosed)
+	return b
+}
+
+// Allow reports whether a call may go ahead
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(stateHalfOpen)
+		b.trialing = true
+		return nil
+	case stateHalfOpen:
+		// Only one trial call at a time
+		if b.trialing {
+			return ErrCircuitOpen
+		}
+		b.trialing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Healthy reports whether calls are currently being let through
+func (b *Breaker) Healthy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != stateOpen || time.Since(b.openedAt) >= b.cooldown
+}
+
+// Success records a successful call
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trialing = false
+	b.setState(stateClosed)
+}
+
+// Abandon releases a trial call that ended without telling us anything about
+// upstream health, e.g. because the caller cancelled
+func (b *Breaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trialing = false
+}
+
+// Failure records a failed call and trips the breaker when needed
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trialing = false
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.setState(stateOpen)
+	}
+}
+
+func (b *Breaker) setState(state breakerState) {
+	b.state = state
+	metrics.CircuitBreakerState.WithLabelValues(b.name).Set(float64(state))
+}
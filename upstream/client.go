@@ -0,0 +1,164 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"stocks-info-channel/logging"
+	"stocks-info-channel/metrics"
+)
+
+// Options tune a Client
+type Options struct {
+	Timeout          time.Duration // per attempt
+	MaxRetries       int
+	RetryBaseDelay   time.Duration
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+// StatusError is returned for a non-2xx response
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// Client is an HTTP client for one upstream API with per-attempt timeouts,
+// retries with jittered backoff on 5xx/429/network errors, and a circuit breaker
+type Client struct {
+	name    string
+	http    *http.Client
+	options Options
+	breaker *Breaker
+}
+
+// NewClient builds a client; name labels its logs and metrics
+func NewClient(name string, options Options) *Client {
+	return &Client{
+		name:    name,
+		http:    &http.Client{},
+		options: options,
+		breaker: NewBreaker(name, options.FailureThreshold, options.Cooldown),
+	}
+}
+
+// Name identifies the upstream
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Healthy reports whether the circuit breaker lets calls through
+func (c *Client) Healthy() bool {
+	return c.breaker.Healthy()
+}
+
+// GetJSON fetches url and decodes the JSON body into out
+func (c *Client) GetJSON(ctx context.Context, url string, out any) error {
+	if err := c.breaker.Allow(); err != nil {
+		return fmt.Errorf("%s: %w", c.name, err)
+	}
+
+	err := c.getWithRetries(ctx, url, out)
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		c.breaker.Success()
+	case ctx.Err() != nil:
+		// The caller gave up; that says nothing about upstream health
+		c.breaker.Abandon()
+	case errors.As(err, &statusErr) && !retryable(statusErr.StatusCode):
+		// 4xx means the request was wrong, the upstream itself is fine
+		c.breaker.Success()
+	default:
+		c.breaker.Failure()
+	}
+	return err
+}
+
+func (c *Client) getWithRetries(ctx context.Context, url string, out any) error {
+	logger := logging.FromContext(ctx).With("upstream", c.name)
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = c.attempt(ctx, url, out)
+		if err == nil {
+			return nil
+		}
+
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && !retryable(statusErr.StatusCode) {
+			return err
+		}
+		if attempt >= c.options.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		delay := c.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		logger.Warn("upstream request failed, retrying", "attempt", attempt+1, "delay_ms", delay.Milliseconds(), "error", err)
+		metrics.UpstreamRetries.WithLabelValues(c.name).Inc()
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// attempt makes a single request; it returns the server's Retry-After hint, if any
+func (c *Client) attempt(ctx context.Context, url string, out any) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return parseRetryAfter(resp.Header.Get("Retry-After")), &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return 0, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// backoff is full jitter exponential backoff: a random delay up to base * 2^attempt
+func (c *Client) backoff(attempt int) time.Duration {
+	ceiling := c.options.RetryBaseDelay << attempt
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(ceiling)))
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds, capped at 10s
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, 10*time.Second)
+}